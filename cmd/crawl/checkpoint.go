@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jbrady42/crawl/core"
+)
+
+// Close stop on the first signal, then abort after a second
+// signal or once the drain timeout passes
+func handleSignals(stop, abort chan struct{}, timeout time.Duration) {
+	sigC := make(chan os.Signal, 2)
+	signal.Notify(sigC, syscall.SIGINT, syscall.SIGTERM)
+
+	<-sigC
+	log.Println("Stopping input, waiting on workers")
+	close(stop)
+
+	select {
+	case <-sigC:
+		log.Println("Stopping now")
+	case <-time.After(timeout):
+		log.Println("Timed out waiting on workers")
+	}
+	close(abort)
+}
+
+// Feed the crawler from stdin, skipping lines consumed by a
+// resumed run, until input ends or stop is closed
+func feedInput(stdinQ <-chan string, inQ chan<- string, resumed *core.Checkpoint, tracker *core.InputTracker, stop <-chan struct{}) {
+	defer close(inQ)
+
+	send := func(line string) bool {
+		select {
+		case inQ <- line:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+
+	if resumed != nil {
+		// Unfinished lines first, already tracked
+		for _, line := range resumed.Pending {
+			if !send(line) {
+				return
+			}
+		}
+		// Skip lines handled by the last run
+		for i := 0; i < resumed.Consumed; i++ {
+			select {
+			case _, ok := <-stdinQ:
+				if !ok {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case line, ok := <-stdinQ:
+			if !ok {
+				return
+			}
+			tracker.Add(line, true)
+			if !send(line) {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func saveCheckpoint(tracker *core.InputTracker, path string) {
+	cp := tracker.Checkpoint()
+	if path == "" {
+		log.Println("No checkpoint file,", len(cp.Pending), "urls unfinished")
+		return
+	}
+	if err := cp.Save(path); err != nil {
+		log.Println("Error writing checkpoint:", err)
+		return
+	}
+	log.Println("Wrote checkpoint", path, "with", len(cp.Pending), "urls unfinished")
+}
@@ -2,27 +2,100 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/jbrady42/crawl/core"
 	"github.com/jbrady42/crawl/data"
 	"github.com/jbrady42/crawl/util"
+	"github.com/jbrady42/crawl/warc"
 )
 
 func downloadMain() {
-	inQ := util.NewStdinReader(workers)
+	stdinQ := util.NewStdinReader(workers)
+	inQ := make(chan string, workers)
 	outQ := make(chan *data.PageResult, workers)
 
+	// Pick up an interrupted run
+	var resumed *core.Checkpoint
+	tracker := core.NewInputTracker(0)
+	if resume {
+		cp, err := core.LoadCheckpoint(checkpointFile)
+		if err != nil {
+			log.Fatal("Error reading checkpoint: ", err)
+		}
+		log.Println("Resuming", len(cp.Pending), "urls, skipping", cp.Consumed, "lines")
+		resumed = cp
+		tracker = core.NewInputTracker(cp.Consumed)
+		for _, line := range cp.Pending {
+			tracker.Add(line, false)
+		}
+	}
+
+	stop := make(chan struct{})
+	abort := make(chan struct{})
+	go handleSignals(stop, abort, drainTimeout)
+	go feedInput(stdinQ, inQ, resumed, tracker, stop)
+
 	// Setup crawler
 	servers := []string{} // Use default servers
 
 	crawl := core.NewCrawler(workers, groupHost, servers)
 	crawl.MaxPageBytes = sizeLimit
 	crawl.IgnoreRobots = ignoreRobot
+	crawl.RobotsCacheDir = robotsDir
 	crawl.Insecure = insecure
+	crawl.Compress = compress
+	crawl.Accept = splitList(acceptTypes)
+	crawl.Reject = splitList(rejectTypes)
+	crawl.HeadCheck = headCheck
+	if proxyStr != "" {
+		proxy, err := core.ParseProxy(proxyStr)
+		if err != nil {
+			log.Fatal("Bad proxy: ", err)
+		}
+		crawl.Proxy = proxy
+	}
+	if proxyRules != "" {
+		rules, err := core.LoadProxyRules(proxyRules)
+		if err != nil {
+			log.Fatal("Error loading proxy rules: ", err)
+		}
+		crawl.ProxyRules = rules
+	}
+	if userAgent != "" {
+		crawl.UserAgent = userAgent
+	}
+	if hostConfig != "" {
+		profiles, err := core.LoadHostProfiles(hostConfig)
+		if err != nil {
+			log.Fatal("Error loading host config: ", err)
+		}
+		crawl.AddHostProfiles(profiles)
+	}
+	var jar *core.CookieJar
+	if cookieFile != "" {
+		var err error
+		jar, err = core.LoadCookieJar(cookieFile)
+		if err != nil {
+			log.Fatal("Error loading cookies: ", err)
+		}
+		crawl.Jar = jar
+	}
+	crawl.SetRateLimited(rateMB)
+	crawl.SetHostRateLimited(hostRateMB)
+	crawl.MinCrawlDelay = minDelay
+	crawl.MaxCrawlDelay = maxDelay
+	crawl.MaxRedirects = maxRedirects
+	crawl.StayOnHost = stayOnHost
+	crawl.Retry = core.NewRetryPolicy(attempts)
+	crawl.Retry.BaseDelay = retryDelay
+	crawl.Retry.MaxDelay = maxRetryDelay
+	crawl.Tracker = tracker
 
 	go func() {
 		crawl.Download(inQ, outQ)
@@ -30,9 +103,60 @@ func downloadMain() {
 	}()
 
 	//Output
-	for a := range outQ {
-		fmt.Println(util.ToJSONStr(a))
+	write := pageWriter(os.Stdout)
+output:
+	for {
+		select {
+		case a, ok := <-outQ:
+			if !ok {
+				break output
+			}
+			write(a)
+			tracker.Done(a)
+		case <-abort:
+			break output
+		}
 	}
+
+	if jar != nil {
+		if err := jar.Save(cookieFile); err != nil {
+			log.Println("Error saving cookies:", err)
+		}
+	}
+
+	// Record where we stopped
+	select {
+	case <-stop:
+		saveCheckpoint(tracker, checkpointFile)
+	default:
+	}
+}
+
+func pageWriter(out io.Writer) func(*data.PageResult) {
+	switch outFormat {
+	case "warc":
+		writer := warc.NewWriter(out)
+		return func(a *data.PageResult) {
+			if err := writer.WritePage(a); err != nil {
+				log.Fatal("Error writing warc: ", err)
+			}
+		}
+	default:
+		return func(a *data.PageResult) {
+			fmt.Fprintln(out, util.ToJSONStr(a))
+		}
+	}
+}
+
+// Split a comma separated flag value
+func splitList(str string) []string {
+	var res []string
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
 }
 
 func resolveMain() {
@@ -65,17 +189,64 @@ func resolveMain() {
 	}
 }
 
-func extractMain() {
-	inQ := util.NewStdinReader(0)
-	outQ := make(chan *data.PageResult)
+func robotsMain() {
+	inQ := util.NewStdinReader(workers)
+	outQ := make(chan *data.RobotsResult, workers)
+
+	servers := []string{} // Use default servers
+
+	crawl := core.NewCrawler(workers, false, servers)
+	crawl.RobotsCacheDir = robotsDir
+	if userAgent != "" {
+		crawl.UserAgent = userAgent
+	}
 
 	go func() {
-		core.ExtractMain(inQ, outQ, siteRoot)
+		crawl.RobotsCheck(inQ, outQ)
 		close(outQ)
 	}()
 
+	//Output
+	for a := range outQ {
+		if onlyAllowed {
+			if a.Allowed {
+				fmt.Println(a.Url)
+			}
+		} else {
+			fmt.Println(util.ToJSONStr(a))
+		}
+	}
+}
+
+func extractMain(files []string) {
+	outQ := make(chan *data.PageResult)
+
+	if inFormat == "warc" {
+		pageQ := make(chan *data.PageResult)
+		go readWarcPages(files, pageQ)
+
+		go func() {
+			core.ExtractPages(pageQ, outQ, siteRoot)
+			close(outQ)
+		}()
+	} else {
+		inQ := util.NewStdinReader(0)
+
+		go func() {
+			core.ExtractMain(inQ, outQ, siteRoot)
+			close(outQ)
+		}()
+	}
+
 	// Output
 	for a := range outQ {
+		if a.Data.Truncated {
+			if skipTruncated {
+				log.Println("Skipping truncated page:", a.Data.Url)
+				continue
+			}
+			log.Println("Warning, links from truncated page:", a.Data.Url)
+		}
 		links := a.Links
 		for _, l := range links {
 			fmt.Println(l.String())
@@ -83,6 +254,50 @@ func extractMain() {
 	}
 }
 
+// Read response records from warc files or stdin
+func readWarcPages(files []string, outQ chan<- *data.PageResult) {
+	if len(files) == 0 {
+		readWarc(os.Stdin, outQ)
+	}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Println("Error opening warc:", err)
+			continue
+		}
+		readWarc(f, outQ)
+		f.Close()
+	}
+	close(outQ)
+}
+
+func readWarc(in io.Reader, outQ chan<- *data.PageResult) {
+	reader, err := warc.NewReader(in)
+	if err != nil {
+		log.Println("Error reading warc:", err)
+		return
+	}
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Println("Error reading warc record:", err)
+			return
+		}
+		if rec.Type() != warc.TypeResponse {
+			continue
+		}
+		page, err := warc.PageFromRecord(rec)
+		if err != nil {
+			log.Println("Error parsing warc response:", err)
+			continue
+		}
+		outQ <- page
+	}
+}
+
 func printMain() {
 	inQ := util.NewStdinReader(0)
 	for a := range inQ {
@@ -98,6 +313,32 @@ var ignoreRobot bool
 var siteRoot bool
 var cacheSize int
 var insecure bool
+var compress bool
+var acceptTypes string
+var rejectTypes string
+var headCheck bool
+var proxyStr string
+var proxyRules string
+var hostConfig string
+var cookieFile string
+var outFormat string
+var inFormat string
+var robotsDir string
+var userAgent string
+var onlyAllowed bool
+var minDelay time.Duration
+var maxDelay time.Duration
+var attempts int
+var rateMB float64
+var checkpointFile string
+var resume bool
+var drainTimeout time.Duration
+var hostRateMB float64
+var retryDelay time.Duration
+var maxRetryDelay time.Duration
+var maxRedirects int
+var stayOnHost bool
+var skipTruncated bool
 
 func main() {
 
@@ -118,9 +359,23 @@ func main() {
 					Usage:       "Only extract site roots",
 					Destination: &siteRoot,
 				},
+				cli.StringFlag{
+					Name:        "input",
+					Value:       "json",
+					Usage:       "Input format, json or warc. Warc files may be given as arguments",
+					Destination: &inFormat,
+				},
+				cli.BoolFlag{
+					Name:        "skip-truncated",
+					Usage:       "Skip pages cut at max bytes instead of warning",
+					Destination: &skipTruncated,
+				},
 			},
 			Action: func(c *cli.Context) {
-				extractMain()
+				if inFormat != "json" && inFormat != "warc" {
+					log.Fatal("Unknown input format: ", inFormat)
+				}
+				extractMain(c.Args())
 			},
 		},
 		{
@@ -141,6 +396,18 @@ func main() {
 					Usage:       "Limit download page size rate. 0 for none.",
 					Destination: &sizeLimit,
 				},
+				cli.Float64Flag{
+					Name:        "rate-mb",
+					Value:       0.0,
+					Usage:       "Limit total download rate in MB/s. 0 for none.",
+					Destination: &rateMB,
+				},
+				cli.Float64Flag{
+					Name:        "host-rate-mb",
+					Value:       0.0,
+					Usage:       "Limit download rate per host in MB/s. 0 for none.",
+					Destination: &hostRateMB,
+				},
 				cli.BoolFlag{
 					Name:        "host",
 					Usage:       "Urls are input in groups by host",
@@ -151,16 +418,177 @@ func main() {
 					Usage:       "Disable robots.txt checking",
 					Destination: &ignoreRobot,
 				},
+				cli.StringFlag{
+					Name:        "robots-cache",
+					Value:       "",
+					Usage:       "Directory to keep robots.txt between runs",
+					Destination: &robotsDir,
+				},
 				cli.BoolFlag{
 					Name:        "insecure",
 					Usage:       "Disable SSL verification",
 					Destination: &insecure,
 				},
+				cli.BoolFlag{
+					Name:        "compress",
+					Usage:       "Request gzip, br or zstd encoded pages, stored decoded",
+					Destination: &compress,
+				},
+				cli.StringFlag{
+					Name:        "accept",
+					Value:       "",
+					Usage:       "Comma separated content types to download, like text/html,text/*",
+					Destination: &acceptTypes,
+				},
+				cli.StringFlag{
+					Name:        "reject",
+					Value:       "",
+					Usage:       "Comma separated content types to skip, like image/*",
+					Destination: &rejectTypes,
+				},
+				cli.BoolFlag{
+					Name:        "head",
+					Usage:       "Check content type with a HEAD request first",
+					Destination: &headCheck,
+				},
+				cli.StringFlag{
+					Name:        "proxy",
+					Value:       "",
+					Usage:       "Proxy url, http, https or socks5. Defaults to the environment",
+					Destination: &proxyStr,
+				},
+				cli.StringFlag{
+					Name:        "proxy-rules",
+					Value:       "",
+					Usage:       "File of host patterns and proxy urls, or direct",
+					Destination: &proxyRules,
+				},
+				cli.StringFlag{
+					Name:        "user-agent",
+					Value:       "",
+					Usage:       "User agent to send and check robots rules for",
+					Destination: &userAgent,
+				},
+				cli.StringFlag{
+					Name:        "host-config",
+					Value:       "",
+					Usage:       "JSON file of per host headers and credentials",
+					Destination: &hostConfig,
+				},
+				cli.StringFlag{
+					Name:        "cookies",
+					Value:       "",
+					Usage:       "File to load and save cookies between runs",
+					Destination: &cookieFile,
+				},
+				cli.DurationFlag{
+					Name:        "min-delay",
+					Value:       1 * time.Second,
+					Usage:       "Min delay between requests to a host",
+					Destination: &minDelay,
+				},
+				cli.DurationFlag{
+					Name:        "max-delay",
+					Value:       30 * time.Second,
+					Usage:       "Max delay between requests to a host, caps robots crawl-delay",
+					Destination: &maxDelay,
+				},
+				cli.IntFlag{
+					Name:        "max-redirects",
+					Value:       10,
+					Usage:       "Max redirects to follow, 0 to not follow",
+					Destination: &maxRedirects,
+				},
+				cli.BoolFlag{
+					Name:        "stay-on-host",
+					Usage:       "Don't follow redirects to other hosts, extract emits them as links",
+					Destination: &stayOnHost,
+				},
+				cli.IntFlag{
+					Name:        "attempts",
+					Value:       1,
+					Usage:       "Max attempts for transient failures",
+					Destination: &attempts,
+				},
+				cli.DurationFlag{
+					Name:        "retry-delay",
+					Value:       1 * time.Second,
+					Usage:       "Base delay between attempts",
+					Destination: &retryDelay,
+				},
+				cli.DurationFlag{
+					Name:        "max-retry-delay",
+					Value:       30 * time.Second,
+					Usage:       "Max delay between attempts",
+					Destination: &maxRetryDelay,
+				},
+				cli.StringFlag{
+					Name:        "checkpoint",
+					Value:       "",
+					Usage:       "File to write unfinished urls to when interrupted",
+					Destination: &checkpointFile,
+				},
+				cli.BoolFlag{
+					Name:        "resume",
+					Usage:       "Resume from the checkpoint file, skipping input it consumed",
+					Destination: &resume,
+				},
+				cli.DurationFlag{
+					Name:        "drain-timeout",
+					Value:       30 * time.Second,
+					Usage:       "Time to wait on workers when interrupted",
+					Destination: &drainTimeout,
+				},
+				cli.StringFlag{
+					Name:        "format",
+					Value:       "json",
+					Usage:       "Output format, json or warc",
+					Destination: &outFormat,
+				},
 			},
 			Action: func(c *cli.Context) {
+				if outFormat != "json" && outFormat != "warc" {
+					log.Fatal("Unknown output format: ", outFormat)
+				}
+				if resume && checkpointFile == "" {
+					log.Fatal("Resume needs a checkpoint file")
+				}
 				downloadMain()
 			},
 		},
+		{
+			// Robots
+			Name:  "robots",
+			Usage: "Check urls against robots.txt",
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:        "workers",
+					Value:       1,
+					Usage:       "Number of robots workers",
+					Destination: &workers,
+				},
+				cli.StringFlag{
+					Name:        "user-agent",
+					Value:       "",
+					Usage:       "User agent to check rules for",
+					Destination: &userAgent,
+				},
+				cli.StringFlag{
+					Name:        "robots-cache",
+					Value:       "",
+					Usage:       "Directory to keep robots.txt between runs",
+					Destination: &robotsDir,
+				},
+				cli.BoolFlag{
+					Name:        "allowed",
+					Usage:       "Only output allowed urls",
+					Destination: &onlyAllowed,
+				},
+			},
+			Action: func(c *cli.Context) {
+				robotsMain()
+			},
+		},
 		{
 			// Resolve
 			Name:    "resolve",
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+
+	"github.com/jbrady42/crawl/data"
+	"github.com/jbrady42/crawl/util"
+)
+
+// Checkpoint of an interrupted download. Consumed counts input
+// lines taken from stdin, Pending holds lines not yet finished.
+type Checkpoint struct {
+	Consumed int
+	Pending  []string
+}
+
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(text, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (t *Checkpoint) Save(path string) error {
+	text, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, text, 0644)
+}
+
+// InputTracker follows input lines until their result is output
+type InputTracker struct {
+	mu       sync.Mutex
+	consumed int
+	pending  map[string][]string
+	sent     map[*data.PageResult]string
+}
+
+func NewInputTracker(consumed int) *InputTracker {
+	return &InputTracker{
+		consumed: consumed,
+		pending:  make(map[string][]string),
+		sent:     make(map[*data.PageResult]string),
+	}
+}
+
+// Add a line handed to the crawler. Lines read from stdin are
+// counted as consumed, resumed lines are not.
+func (t *InputTracker) Add(line string, fromInput bool) {
+	key := newDownloadInfo(line).Url
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if fromInput {
+		t.consumed++
+	}
+	t.pending[key] = append(t.pending[key], line)
+}
+
+// Remember the input of a result, hooks may change its url
+func (t *InputTracker) track(page *data.PageResult, info *DownloadInfo) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sent[page] = info.Url
+}
+
+// Results dropped by hooks are finished without output
+func (t *InputTracker) dropped(info *DownloadInfo) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done(info.Url)
+}
+
+// Done marks the input of page as output
+func (t *InputTracker) Done(page *data.PageResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key, ok := t.sent[page]
+	if ok {
+		delete(t.sent, page)
+	} else if page.Data != nil {
+		// Not from a crawler using this tracker
+		key = page.Data.Url
+	}
+	t.done(key)
+}
+
+func (t *InputTracker) done(key string) {
+	lines := t.pending[key]
+	if len(lines) <= 1 {
+		delete(t.pending, key)
+	} else {
+		t.pending[key] = lines[1:]
+	}
+}
+
+func (t *InputTracker) Checkpoint() *Checkpoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cp := &Checkpoint{Consumed: t.consumed, Pending: []string{}}
+	for _, lines := range t.pending {
+		cp.Pending = append(cp.Pending, lines...)
+	}
+	return cp
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	acceptEncoding = "gzip, br, zstd"
+	// Decompression bomb limits
+	maxDecodedBytes = 512 * 1024 * 1024
+	maxDecodeRatio  = 200
+	minRatioCheck   = 1024 * 1024
+)
+
+var errDecodeBomb = errors.New("decompressed size exceeds limit")
+
+// Counts bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (t *countingReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+	return n, err
+}
+
+// Fails reads once the decoded size is out of proportion to the wire size
+type bombReader struct {
+	r    io.Reader
+	wire *countingReader
+	n    int64
+}
+
+func (t *bombReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.n += int64(n)
+	if t.n > maxDecodedBytes {
+		return n, errDecodeBomb
+	}
+	if t.n > minRatioCheck && t.n > t.wire.n*maxDecodeRatio {
+		return n, errDecodeBomb
+	}
+	return n, err
+}
+
+func (t *bombReader) Close() error {
+	if c, ok := t.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Wrap the wire reader in a decoder for the response Content-Encoding.
+// Returns the encoding decoded, empty if the body is passed through.
+func decodeResponse(resp *http.Response, wire *countingReader) (io.Reader, string, error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+
+	var r io.Reader
+	switch encoding {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(wire)
+		switch {
+		case err == io.EOF:
+			// Empty body
+			r = strings.NewReader("")
+		case err != nil:
+			return nil, "", err
+		default:
+			r = gz
+		}
+	case "br":
+		r = brotli.NewReader(wire)
+	case "zstd":
+		zr, err := zstd.NewReader(wire, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, "", err
+		}
+		r = zr.IOReadCloser()
+	default:
+		// Identity or unknown, keep as is
+		return wire, "", nil
+	}
+
+	// Body is stored decoded
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	return &bombReader{r: r, wire: wire}, encoding, nil
+}
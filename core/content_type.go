@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/jbrady42/crawl/data"
+	"github.com/jbrady42/crawl/util"
+)
+
+// Untyped content per RFC 7231
+const defaultContentType = "application/octet-stream"
+
+// Match a media type against a pattern like text/html, image/* or */*
+func matchType(pattern, mediaType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "*/*" || pattern == "*" || pattern == mediaType {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+// Check a Content-Type against the accept and reject lists.
+// Returns the reason when not wanted.
+func (t *Crawler) acceptedType(contentType string) (bool, string) {
+	if len(t.Accept) == 0 && len(t.Reject) == 0 {
+		return true, ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = defaultContentType
+	}
+
+	for _, pattern := range t.Reject {
+		if matchType(pattern, mediaType) {
+			return false, "Rejected content type " + mediaType
+		}
+	}
+	if len(t.Accept) == 0 {
+		return true, ""
+	}
+	for _, pattern := range t.Accept {
+		if matchType(pattern, mediaType) {
+			return true, ""
+		}
+	}
+	return false, "Content type not accepted " + mediaType
+}
+
+// Result for a response whose body was not read
+func newSkippedResult(url string, resp *http.Response, reason string) *data.PageResult {
+	page := data.NewPageData(url, resp, nil)
+	page.Success = false
+	page.Message = reason
+	page.SkipReason = reason
+	return page
+}
+
+// Ask for the content type with HEAD before downloading.
+// Returns nil when the page should be fetched.
+func (t *DownloadWorker) headCheck(ctx context.Context, info *DownloadInfo) *data.PageResult {
+	if len(t.crawler.Accept) == 0 && len(t.crawler.Reject) == 0 {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "HEAD", info.Url, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Add("Accept-Encoding", "identity")
+
+	timer := newRequestTimer()
+	resp, _, err := t.fetchFollow(timer.withTrace(req))
+	if err != nil {
+		// Let GET decide
+		return nil
+	}
+	resp.Body.Close()
+
+	// Servers without HEAD support
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil
+	}
+	if ok, reason := t.crawler.acceptedType(resp.Header.Get("Content-Type")); !ok {
+		log.Println(reason, info.Url)
+		page := newSkippedResult(info.Url, resp, reason)
+		page.Data.IP = t.crawler.responseIP(resp, timer)
+		return page
+	}
+	// Respect host crawl delay before the GET
+	t.waitForHost(ctx, util.ParseUrl(info.Url))
+	return nil
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/jbrady42/crawl/util"
+)
+
+// CookieJar is a cookiejar.Jar that can be saved and loaded.
+// The standard jar can't list its cookies, so they are kept as set.
+type CookieJar struct {
+	jar *cookiejar.Jar
+
+	mu      sync.Mutex
+	entries map[string]*storedCookie
+}
+
+type storedCookie struct {
+	Url    string
+	Cookie *http.Cookie
+}
+
+func NewCookieJar() *CookieJar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &CookieJar{jar: jar, entries: make(map[string]*storedCookie)}
+}
+
+// LoadCookieJar reads a saved jar, a missing file gives an empty jar
+func LoadCookieJar(path string) (*CookieJar, error) {
+	jar := NewCookieJar()
+	text, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return jar, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []*storedCookie
+	if err := json.Unmarshal(text, &stored); err != nil {
+		return nil, err
+	}
+	for _, item := range stored {
+		u, err := url.Parse(item.Url)
+		if err != nil || item.Cookie == nil {
+			continue
+		}
+		jar.SetCookies(u, []*http.Cookie{item.Cookie})
+	}
+	return jar, nil
+}
+
+func (t *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	t.jar.SetCookies(u, cookies)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range cookies {
+		cookie := *c
+		// Saved cookies need an absolute expiry
+		if cookie.MaxAge > 0 {
+			cookie.Expires = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+			cookie.MaxAge = 0
+		}
+		cookie.Raw = ""
+		domain := cookie.Domain
+		if domain == "" {
+			domain = u.Hostname()
+		}
+		key := domain + ";" + cookie.Path + ";" + cookie.Name
+		t.entries[key] = &storedCookie{u.String(), &cookie}
+	}
+}
+
+func (t *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return t.jar.Cookies(u)
+}
+
+// Save writes cookies that have not expired or been deleted
+func (t *CookieJar) Save(path string) error {
+	t.mu.Lock()
+	var stored []*storedCookie
+	now := time.Now()
+	for _, item := range t.entries {
+		c := item.Cookie
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			continue
+		}
+		stored = append(stored, item)
+	}
+	t.mu.Unlock()
+
+	text, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(path, text, 0600)
+}
@@ -1,42 +1,77 @@
 package core
 
 import (
-	"github.com/hashicorp/golang-lru"
+	"net/http"
+	"net/url"
+	"time"
+
 	"github.com/jbrady42/crawl/resolve"
 	"github.com/juju/ratelimit"
 )
 
 type Crawler struct {
-	UserAgent    string
-	WorkerCount  int
-	GroupByHost  bool
-	RateLimitMB  float64
-	RateBucket   *ratelimit.Bucket
-	MaxPageBytes int
-	IgnoreRobots bool
-	Insecure     bool
-	Resolver     *resolve.Resolver
-	robotsCache  *lru.Cache
+	UserAgent       string
+	WorkerCount     int
+	GroupByHost     bool
+	RateLimitMB     float64
+	RateBucket      *ratelimit.Bucket
+	HostRateLimitMB float64
+	MaxPageBytes    int
+	IgnoreRobots    bool
+	Insecure        bool
+	Compress        bool
+	Accept          []string
+	Reject          []string
+	HeadCheck       bool
+	Proxy           *url.URL
+	ProxyRules      []ProxyRule
+	Jar             http.CookieJar
+	RobotsCacheDir  string
+	MinCrawlDelay   time.Duration
+	MaxCrawlDelay   time.Duration
+	MaxRedirects    int
+	StayOnHost      bool
+	Retry           *RetryPolicy
+	Fetcher         Fetcher
+	Tracker         *InputTracker
+	Resolver        *resolve.Resolver
+	robotsCache     *robotsCache
+	throttle        *hostThrottle
+	hostBuckets     *hostBuckets
+	requestHooks    []RequestHook
+	secretHeaders   []string
+	resultHooks     []ResultHook
 }
 
 func NewCrawler(workers int, groupHost bool, servers []string) *Crawler {
 
 	crawler := &Crawler{
-		UserAgent:    "Smith",
-		WorkerCount:  workers,
-		GroupByHost:  groupHost,
-		RateLimitMB:  0.0,
-		RateBucket:   nil,
-		MaxPageBytes: -1,
+		UserAgent:     "Smith",
+		WorkerCount:   workers,
+		GroupByHost:   groupHost,
+		RateLimitMB:   0.0,
+		RateBucket:    nil,
+		MaxPageBytes:  -1,
+		MinCrawlDelay: defaultCrawlDelay,
+		MaxCrawlDelay: defaultMaxCrawlDelay,
+		MaxRedirects:  defaultMaxRedirects,
+		Retry:         NewRetryPolicy(1),
+		throttle:      newHostThrottle(),
 	}
 
-	robotCache, _ := lru.New(500)
-	crawler.robotsCache = robotCache
+	crawler.robotsCache = newRobotsCache()
 
 	crawler.Resolver = resolve.NewWithServers(servers)
 
 	// Setup rate limiting
-	//SetRateLimited(0.0)
+	crawler.SetRateLimited(0.0)
 
 	return crawler
 }
+
+// Send the agent robots are checked for, hooks may replace it
+func (t *Crawler) setUserAgent(req *http.Request) {
+	if t.UserAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", t.UserAgent)
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// Wait before racing the next address, as in RFC 8305
+const fallbackDelay = 250 * time.Millisecond
+
+var errNoAddresses = errors.New("no addresses to dial")
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+func dialIP(ctx context.Context, network string, ip net.IP, port string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+}
+
+// Dial addresses in order, starting the next when one fails or is slower
+// than fallbackDelay. The first connection wins, the rest are closed.
+// More addresses are asked for once when the list runs out.
+func dialStaggered(ctx context.Context, network, port string, ips []net.IP, more func() []net.IP) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan dialResult)
+	pending := 0
+	lastErr := error(&net.OpError{Op: "dial", Net: network, Err: errNoAddresses})
+
+	for next := 0; ; {
+		if next == len(ips) && more != nil {
+			// Without waiting for the pending dial
+			ips = append(ips, more()...)
+			more = nil
+		}
+		if next == len(ips) && pending == 0 {
+			return nil, lastErr
+		}
+
+		if next < len(ips) {
+			ip := ips[next]
+			go func() {
+				conn, err := dialIP(ctx, network, ip, port)
+				results <- dialResult{conn, err}
+			}()
+			next++
+			pending++
+		}
+		var fallback <-chan time.Time
+		if next < len(ips) || more != nil {
+			fallback = time.After(fallbackDelay)
+		}
+
+		// A failure starts the next address right away
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				go closeDials(results, pending)
+				return res.conn, nil
+			}
+			lastErr = res.err
+		case <-fallback:
+		case <-ctx.Done():
+			go closeDials(results, pending)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close connections from dials that lost the race
+func closeDials(results <-chan dialResult, pending int) {
+	for ; pending > 0; pending-- {
+		if res := <-results; res.conn != nil {
+			res.conn.Close()
+		}
+	}
+}
+
+// Alternate address families, keeping the first address first
+func interleave(ips []net.IP) []net.IP {
+	if len(ips) == 0 {
+		return ips
+	}
+	var first, other []net.IP
+	isV4 := ips[0].To4() != nil
+	for _, ip := range ips {
+		if (ip.To4() != nil) == isV4 {
+			first = append(first, ip)
+		} else {
+			other = append(other, ip)
+		}
+	}
+
+	res := make([]net.IP, 0, len(ips))
+	for i := 0; i < len(first) || i < len(other); i++ {
+		if i < len(first) {
+			res = append(res, first[i])
+		}
+		if i < len(other) {
+			res = append(res, other[i])
+		}
+	}
+	return res
+}
+
+func withoutIP(ips []net.IP, skip net.IP) []net.IP {
+	var res []net.IP
+	for _, ip := range ips {
+		if !ip.Equal(skip) {
+			res = append(res, ip)
+		}
+	}
+	return res
+}
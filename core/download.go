@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"io"
@@ -9,21 +10,18 @@ import (
 	"log"
 	"net"
 	"net/http"
-	"net/url"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/jbrady42/crawl/data"
 	"github.com/jbrady42/crawl/util"
 	"github.com/jbrady42/syncmap"
-	"github.com/temoto/robotstxt-go"
 )
 
 const (
 	defaultTimeout    = time.Duration(60 * time.Second)
-	hostCrawlDelay    = time.Duration(1 * time.Second)
 	hostWorkerTimeout = 1 * time.Second
+	idleConnTimeout   = 90 * time.Second
 	statsInterval     = 3 * time.Second
 	maxBatchItems     = 1000
 )
@@ -31,6 +29,7 @@ const (
 type DownloadWorker struct {
 	crawler     *Crawler
 	client      *http.Client
+	fetcher     Fetcher
 	currentInfo *DownloadInfo
 }
 
@@ -42,25 +41,31 @@ type HostWorker struct {
 }
 
 func (t *Crawler) Download(inQ <-chan string, outQ chan<- *data.PageResult) {
+	t.DownloadContext(context.Background(), inQ, outQ)
+}
+
+// DownloadContext stops taking input and returns once ctx is done.
+// In flight requests are cancelled.
+func (t *Crawler) DownloadContext(ctx context.Context, inQ <-chan string, outQ chan<- *data.PageResult) {
 	if t.GroupByHost {
-		t.downloadPerHost(inQ, outQ)
+		t.downloadPerHost(ctx, inQ, outQ)
 	} else {
-		t.downloadAll(inQ, outQ)
+		t.downloadAll(ctx, inQ, outQ)
 	}
 }
 
-func (t *Crawler) downloadAll(inQ <-chan string, outQ chan<- *data.PageResult) {
+func (t *Crawler) downloadAll(ctx context.Context, inQ <-chan string, outQ chan<- *data.PageResult) {
 
 	var wg sync.WaitGroup
 	infoQ := make(chan *DownloadInfo)
 
-	go toDownloadInfo(inQ, infoQ)
+	go toDownloadInfo(ctx, inQ, infoQ)
 
 	wg.Add(t.WorkerCount)
 	for i := 0; i < t.WorkerCount; i++ {
 		time.Sleep(25 * time.Millisecond)
 
-		go t.launchDownloadWorker(infoQ, outQ, &wg)
+		go t.launchDownloadWorker(ctx, infoQ, outQ, &wg)
 	}
 
 	log.Println("Waiting on workers")
@@ -82,9 +87,13 @@ func writeStats(stats CrawlStats) {
 	}
 }
 
-func crwalStatsWorker(hostMap *syncmap.Map) {
+func crwalStatsWorker(done <-chan struct{}, hostMap *syncmap.Map) {
 	for {
-		time.Sleep(statsInterval)
+		select {
+		case <-time.After(statsInterval):
+		case <-done:
+			return
+		}
 		var count, closeCount int
 		countMap := make(map[string]int)
 		for tmp := range hostMap.Iter() {
@@ -109,9 +118,14 @@ func crwalStatsWorker(hostMap *syncmap.Map) {
 	}
 }
 
-func workerCloseWatcher(worker *HostWorker) {
+func workerCloseWatcher(ctx context.Context, worker *HostWorker) {
 	for {
-		time.Sleep(hostWorkerTimeout)
+		select {
+		case <-time.After(hostWorkerTimeout):
+		case <-ctx.Done():
+			// Worker stops on its own
+			return
+		}
 		qLen := len(worker.inQ)
 		log.Println("worker: ", worker.key, "length:", qLen)
 		if qLen == 0 {
@@ -123,16 +137,18 @@ func workerCloseWatcher(worker *HostWorker) {
 	}
 }
 
-func (t *Crawler) downloadPerHost(inQ <-chan string, outQ chan<- *data.PageResult) {
+func (t *Crawler) downloadPerHost(ctx context.Context, inQ <-chan string, outQ chan<- *data.PageResult) {
 	var wg sync.WaitGroup
 	infoQ := make(chan *DownloadInfo)
 	closeChan := make(chan string, t.WorkerCount)
 	workerMap := syncmap.New()
+	statsDone := make(chan struct{})
+	defer close(statsDone)
 
 	// Transform input
-	go toDownloadInfo(inQ, infoQ)
+	go toDownloadInfo(ctx, inQ, infoQ)
 	//Launch worker stats
-	go crwalStatsWorker(workerMap)
+	go crwalStatsWorker(statsDone, workerMap)
 	// Find or create worker
 	for info := range infoQ {
 		var q chan *DownloadInfo
@@ -144,10 +160,14 @@ func (t *Crawler) downloadPerHost(inQ <-chan string, outQ chan<- *data.PageResul
 			q = tmp.(*HostWorker).inQ
 		} else {
 			// Create new worker
-			for workerMap.Len() >= t.WorkerCount {
+			for workerMap.Len() >= t.WorkerCount && ctx.Err() == nil {
 				log.Println("Waiting for free workers")
-				// Wait for worker to finish
-				<-closeChan
+				// Wait for worker to finish, notices may be dropped
+				select {
+				case <-closeChan:
+				case <-time.After(hostWorkerTimeout):
+				case <-ctx.Done():
+				}
 			}
 
 			log.Println("Adding new worker", hostKey)
@@ -157,14 +177,17 @@ func (t *Crawler) downloadPerHost(inQ <-chan string, outQ chan<- *data.PageResul
 			workerMap.Set(hostKey, worker)
 
 			wg.Add(1)
-			go t.launchHostDownloadWorker(&wg, worker, workerMap, closeChan)
+			go t.launchHostDownloadWorker(ctx, &wg, worker, workerMap, closeChan)
 
 			// Worker empty timeout
-			go workerCloseWatcher(worker)
+			go workerCloseWatcher(ctx, worker)
 		}
 
 		// Add into to correct host queue
-		q <- info
+		select {
+		case q <- info:
+		case <-ctx.Done():
+		}
 	}
 
 	log.Println("Waiting on workers")
@@ -172,154 +195,332 @@ func (t *Crawler) downloadPerHost(inQ <-chan string, outQ chan<- *data.PageResul
 	log.Println("Exiting Download")
 }
 
-func (t *Crawler) launchHostDownloadWorker(wg *sync.WaitGroup, worker *HostWorker, workerMap *syncmap.Map, closeChan chan string) {
+func (t *Crawler) launchHostDownloadWorker(ctx context.Context, wg *sync.WaitGroup, worker *HostWorker, workerMap *syncmap.Map, closeChan chan string) {
 	time.Sleep(100 * time.Millisecond)
-	t.launchDownloadWorker(worker.inQ, worker.outQ, wg)
+	t.launchDownloadWorker(ctx, worker.inQ, worker.outQ, wg)
 
 	// Clear host from maps
 	workerMap.Delete(worker.key)
 	log.Println("Removing worker", worker.key)
-	// Notify of finish when worker exits
-	closeChan <- worker.key
+	// Notify of finish when worker exits, without blocking
+	select {
+	case closeChan <- worker.key:
+	default:
+	}
 }
 
-func (t *Crawler) launchBatchDownloadWorker(batchQ <-chan chan *DownloadInfo, outQ chan<- *data.PageResult, wg *sync.WaitGroup) {
+func (t *Crawler) launchBatchDownloadWorker(ctx context.Context, batchQ <-chan chan *DownloadInfo, outQ chan<- *data.PageResult, wg *sync.WaitGroup) {
 	for q := range batchQ {
 		// Add for the extra done in worker
 		wg.Add(1)
-		t.launchDownloadWorker(q, outQ, wg)
+		t.launchDownloadWorker(ctx, q, outQ, wg)
 	}
 	wg.Done()
 }
 
-func (t *Crawler) launchDownloadWorker(infoQ <-chan *DownloadInfo, outQ chan<- *data.PageResult, wg *sync.WaitGroup) {
+func (t *Crawler) launchDownloadWorker(ctx context.Context, infoQ <-chan *DownloadInfo, outQ chan<- *data.PageResult, wg *sync.WaitGroup) {
 	log.Println("Worker starting")
 	defer wg.Done()
-	// Build worker first
-	worker := DownloadWorker{t, nil, nil}
-	// Create and add client
-	client := httpClient(&worker)
-	worker.client = client
+	worker := t.newDownloadWorker()
 
-	worker.downloadUrls(infoQ, outQ)
+	worker.downloadUrls(ctx, infoQ, outQ)
+	if worker.client != nil {
+		worker.client.CloseIdleConnections()
+	}
 	log.Println("Worker finished")
 }
 
-func (t *DownloadWorker) downloadUrls(inQ <-chan *DownloadInfo, outQ chan<- *data.PageResult) {
-	for info := range inQ {
+func (t *Crawler) newDownloadWorker() *DownloadWorker {
+	// Build worker first
+	worker := &DownloadWorker{crawler: t, fetcher: t.Fetcher}
+	if worker.fetcher == nil {
+		// Create and add client
+		client := httpClient(worker)
+		worker.client = client
+		worker.fetcher = &clientFetcher{client}
+	}
+	return worker
+}
+
+func (t *DownloadWorker) downloadUrls(ctx context.Context, inQ <-chan *DownloadInfo, outQ chan<- *data.PageResult) {
+	for {
+		var info *DownloadInfo
+		select {
+		case in, ok := <-inQ:
+			if !ok {
+				return
+			}
+			info = in
+		case <-ctx.Done():
+			return
+		}
+
 		// Set info for dialer
 		t.currentInfo = info
 		urlStr := info.Url
 
 		var page *data.PageResult
 
-		if t.crawler.IgnoreRobots || t.allowedByRobots(urlStr) {
-			page = t.downloadUrl(urlStr)
+		allowed, reason := true, ""
+		if !t.crawler.IgnoreRobots {
+			allowed, reason = t.allowedByRobots(ctx, urlStr)
+		}
+
+		if allowed {
+			// Respect host crawl delay
+			t.waitForHost(ctx, util.ParseUrl(urlStr))
+			page = t.downloadPage(ctx, info)
 		} else {
-			log.Println("Blocked by robots")
-			page = data.NewFailedResult(urlStr, "Blocked by robots")
+			log.Println(reason)
+			page = data.NewFailedResult(urlStr, reason)
 		}
 
-		outQ <- page
+		t.crawler.redactHeaders(page)
+		page = t.crawler.runResultHooks(page, info)
+		if page == nil {
+			log.Println("Dropped by hook:", urlStr)
+			t.crawler.Tracker.dropped(info)
+			continue
+		}
+		t.crawler.Tracker.track(page, info)
+
+		select {
+		case outQ <- page:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-		// Sleep if needed
-		if t.crawler.GroupByHost && len(inQ) > 0 {
-			time.Sleep(hostCrawlDelay)
+// Download with validators from a previous fetch
+func (t *DownloadWorker) downloadPage(ctx context.Context, info *DownloadInfo) *data.PageResult {
+	req, err := t.newRequest(ctx, info.Url)
+	if err != nil {
+		return data.NewFailedResult(info.Url, err.Error())
+	}
+	if info.ETag != "" {
+		req.Header.Set("If-None-Match", info.ETag)
+	}
+	if info.LastModified != "" {
+		req.Header.Set("If-Modified-Since", info.LastModified)
+	}
+	if t.crawler.HeadCheck {
+		if page := t.headCheck(ctx, info); page != nil {
+			return page
 		}
 	}
+
+	page := t.fetch(ctx, info.Url, req)
+	if page.Data.StatusCode == http.StatusNotModified {
+		log.Println("Not modified:", info.Url)
+		page.NotModified = true
+		page.Message = "not modified"
+	}
+	return page
 }
 
-func (t *DownloadWorker) downloadUrl(url string) (page *data.PageResult) {
-	req, err := http.NewRequest("GET", url, nil)
+func (t *DownloadWorker) newRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		log.Print("Error creating request: ", url)
 		log.Printf("%s\n", err)
-		return data.NewFailedResult(url, err.Error())
+		return nil, err
 	}
-	req.Header.Add("Accept-Encoding", "identity")
+	if t.crawler.Compress {
+		req.Header.Add("Accept-Encoding", acceptEncoding)
+	} else {
+		req.Header.Add("Accept-Encoding", "identity")
+	}
+	return req, nil
+}
 
-	resp, err := t.client.Do(req)
+func (t *DownloadWorker) fetch(ctx context.Context, url string, req *http.Request) *data.PageResult {
+	var attempts []data.Attempt
+
+	for attempt := 1; ; attempt++ {
+		page, resp, err := t.fetchOnce(url, req)
+
+		wait, retry := t.crawler.Retry.next(attempt, resp, err)
+		attempts = append(attempts, data.NewAttempt(page, err, wait))
+
+		if !retry {
+			page.Attempts = attempts
+			return page
+		}
+		log.Printf("Retrying %s in %v\n", url, wait)
+		if !sleepContext(ctx, wait) {
+			page.Attempts = attempts
+			return page
+		}
+		// The backoff may be shorter than the crawl delay
+		t.waitForHost(ctx, req.URL)
+	}
+}
+
+func (t *DownloadWorker) fetchOnce(url string, req *http.Request) (*data.PageResult, *http.Response, error) {
+	timer := newRequestTimer()
+	resp, hops, err := t.fetchFollow(timer.withTrace(req))
 	if resp != nil {
 		defer resp.Body.Close()
 	}
 	if err != nil {
 		log.Printf("Error downloading %s : %s\n", url, err)
-		return data.NewFailedResult(url, err.Error())
+		page := data.NewFailedResult(url, err.Error())
+		page.Data.Redirects = hops
+		page.Data.Timing = timer.done()
+		return page, nil, err
+	}
+
+	if redirectLocation(resp) == nil {
+		if ok, reason := t.crawler.acceptedType(resp.Header.Get("Content-Type")); !ok {
+			log.Println(reason, url)
+			page := newSkippedResult(url, resp, reason)
+			page.Data.IP = t.crawler.responseIP(resp, timer)
+			page.Data.Redirects = hops
+			page.Data.Timing = timer.done()
+			return page, resp, nil
+		}
 	}
 
 	var body []byte
-	var reader io.Reader
-	reader = resp.Body
+	wire := &countingReader{r: t.crawler.rateLimited(resp.Body, resp.Request.URL.Host)}
+
+	reader, encoding, err := decodeResponse(resp, wire)
+	if err != nil {
+		log.Printf("Error decoding %s : %s\n", url, err)
+		page := data.NewFailedResult(url, err.Error())
+		page.Data.Redirects = hops
+		return page, resp, err
+	}
+	if c, ok := reader.(io.Closer); ok {
+		defer c.Close()
+	}
 
-	// Set up partial reading
-	if t.crawler.MaxPageBytes > 0 {
-		reader = io.LimitReader(resp.Body, int64(t.crawler.MaxPageBytes))
+	// Set up partial reading, limits the decoded size.
+	// One byte over the limit tells a cut page from one that fits.
+	limit := int64(t.crawler.MaxPageBytes)
+	if limit > 0 {
+		reader = io.LimitReader(reader, limit+1)
 	}
 
 	body, err = ioutil.ReadAll(reader)
+	truncated := err != nil
 	if err != nil {
-		log.Println("Error reading response body")
+		log.Println("Error reading response body", err)
+	}
+	if limit > 0 && int64(len(body)) > limit {
+		body = body[:limit]
+		truncated = true
 	}
 	// Close con
 	//resp.Body.Close()
 
 	pd := data.NewPageData(url, resp, body)
+	pd.Data.IP = t.crawler.responseIP(resp, timer)
+	pd.Data.Redirects = hops
+	pd.Data.ContentEncoding = encoding
+	pd.Data.WireBytes = wire.n
+	pd.Data.BytesRead = int64(len(body))
+	pd.Data.ContentLength = resp.ContentLength
+	pd.Data.Truncated = truncated
+	pd.Data.Timing = timer.done()
+	if pd.Data.TLS != nil {
+		pd.Data.TLS.VerifySkipped = t.crawler.Insecure
+	}
+	if err == errDecodeBomb {
+		pd.Message = err.Error()
+	}
+	if redirectLocation(resp) != nil {
+		pd.Message = "Redirect not followed"
+	}
 	log.Printf("Download complete: %s \n", url)
-	return pd
+	return pd, resp, err
 }
 
-func (t *DownloadWorker) dial(network, address string) (net.Conn, error) {
-	parts := strings.Split(address, ":")
-	hostPart := parts[0]
-
-	var resolvedStr string
+func (t *DownloadWorker) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
 
-	if t.currentInfo.IP == nil {
-		resolved, _, err := t.crawler.Resolver.Resolve(hostPart)
-		if err != nil {
-			return nil, err
+	// Only use the input ip for its own host, resolve others when it fails
+	if pinned := t.currentInfo.IP; pinned != nil && t.currentInfo.isHost(host) {
+		fallback := func() []net.IP {
+			ips, err := t.lookupIPs(ctx, host)
+			if err != nil {
+				log.Println("Error resolving fallback", host, err)
+			}
+			return withoutIP(ips, pinned)
 		}
-		resolvedStr = resolved.String()
-	} else {
-		resolvedStr = t.currentInfo.IP.String()
-		// log.Println("Using resolved ip", resolvedStr)
+		return dialStaggered(ctx, network, port, []net.IP{pinned}, fallback)
 	}
 
-	// Recombine port
-	if len(parts) > 1 {
-		resolvedStr += ":" + parts[1]
+	ips, err := t.lookupIPs(ctx, host)
+	if err != nil {
+		return nil, err
 	}
+	return dialStaggered(ctx, network, port, ips, nil)
+}
 
-	return net.Dial(network, resolvedStr)
+func (t *DownloadWorker) lookupIPs(ctx context.Context, host string) (ips []net.IP, err error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	err = traceDNS(ctx, host, func() (err error) {
+		ips, _, err = t.crawler.Resolver.ResolveAllContext(ctx, host)
+		return err
+	})
+	return interleave(ips), err
 }
 
 func httpClient(worker *DownloadWorker) (client *http.Client) {
 	trans := &http.Transport{
-		Dial: func(network, address string) (net.Conn, error) {
-			return worker.dial(network, address)
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return worker.dial(ctx, network, address)
 		},
+		Proxy:               worker.crawler.proxyFor,
 		TLSHandshakeTimeout: 40 * time.Second,
-		DisableKeepAlives:   true,
+		// Host workers only see one ip, reuse connections to it
+		DisableKeepAlives: !worker.crawler.GroupByHost,
+		IdleConnTimeout:   idleConnTimeout,
+		ForceAttemptHTTP2: true,
+		// Server name comes from the request host, not the dialed ip
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: worker.crawler.Insecure,
 		},
 	}
 
+	// Redirects are followed by the worker
 	client = &http.Client{
 		Timeout:   defaultTimeout,
 		Transport: trans,
+		Jar:       worker.crawler.Jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
 	}
 	return client
 }
 
 // Input handling
 
-func toDownloadInfo(inQ <-chan string, outQ chan<- *DownloadInfo) {
-	for s := range inQ {
-		info := newDownloadInfo(s)
-		outQ <- info
+func toDownloadInfo(ctx context.Context, inQ <-chan string, outQ chan<- *DownloadInfo) {
+	defer close(outQ)
+	for {
+		select {
+		case s, ok := <-inQ:
+			if !ok {
+				return
+			}
+			select {
+			case outQ <- newDownloadInfo(s):
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
 	}
-	close(outQ)
 }
 
 func toDownloadInfoBatches(inQ <-chan string, outQ chan<- chan *DownloadInfo) {
@@ -361,36 +562,3 @@ func toDownloadInfoBatches(inQ <-chan string, outQ chan<- chan *DownloadInfo) {
 
 	close(outQ)
 }
-
-func (t *DownloadWorker) robotsTxt(inUrl *url.URL) *robotstxt.RobotsData {
-	roboUrl := util.RobotsUrl(inUrl).String()
-
-	tmp, ok := t.crawler.robotsCache.Get(roboUrl)
-	if !ok {
-		result := t.downloadUrl(roboUrl)
-		text := result.Data.Body
-
-		robots, err := robotstxt.FromString(text)
-		if err != nil {
-			log.Println("Robots error: ", err)
-			return nil
-		}
-		t.crawler.robotsCache.Add(roboUrl, robots)
-		return robots
-	}
-	// log.Println("Cached robots")
-	robots := tmp.(*robotstxt.RobotsData)
-	return robots
-}
-
-func (t *DownloadWorker) allowedByRobots(inUrl string) (allowed bool) {
-	robotsUrl, _ := url.Parse(inUrl)
-	// Fetch robots
-	robots := t.robotsTxt(robotsUrl)
-	if robots == nil {
-		log.Println("No robots")
-		return false
-	}
-	allowed = robots.TestAgent(robotsUrl.Path, t.crawler.UserAgent)
-	return allowed
-}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"log"
 	"net"
 	"net/url"
@@ -15,9 +16,50 @@ import (
 )
 
 func ExtractMain(inQ <-chan string, outQ chan<- *data.PageResult, extractRoot bool) {
-	for s := range inQ {
-		// Parse page data
-		page := data.PageDataFromLine(s)
+	ExtractMainContext(context.Background(), inQ, outQ, extractRoot)
+}
+
+func ExtractMainContext(ctx context.Context, inQ <-chan string, outQ chan<- *data.PageResult, extractRoot bool) {
+	pageQ := make(chan *data.PageResult)
+	go func() {
+		defer close(pageQ)
+		for {
+			select {
+			case s, ok := <-inQ:
+				if !ok {
+					return
+				}
+				// Parse page data
+				select {
+				case pageQ <- data.PageDataFromLine(s):
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	ExtractPagesContext(ctx, pageQ, outQ, extractRoot)
+}
+
+func ExtractPages(inQ <-chan *data.PageResult, outQ chan<- *data.PageResult, extractRoot bool) {
+	ExtractPagesContext(context.Background(), inQ, outQ, extractRoot)
+}
+
+func ExtractPagesContext(ctx context.Context, inQ <-chan *data.PageResult, outQ chan<- *data.PageResult, extractRoot bool) {
+	for {
+		var page *data.PageResult
+		select {
+		case p, ok := <-inQ:
+			if !ok {
+				return
+			}
+			page = p
+		case <-ctx.Done():
+			return
+		}
+
 		// if len(page.Url) < 4 {
 		// 	log.Printf("Error, not extracting. Bad url in line %s\n", line)
 		// 	continue
@@ -29,13 +71,18 @@ func ExtractMain(inQ <-chan string, outQ chan<- *data.PageResult, extractRoot bo
 		links = filterRegLinks(links)
 		page.Links = links
 
-		outQ <- page
+		select {
+		case outQ <- page:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
 // TODO make sure urls are normalized
 func ExtractLinks(page *data.PageData, extractRoot bool) (res []*url.URL) {
-	pageReader := strings.NewReader(page.Body)
+	// Not text leaves only a redirect to link
+	pageReader := strings.NewReader(page.Text())
 	//defer pageReader.Close()
 
 	doc, err := goquery.NewDocumentFromReader(pageReader)
@@ -45,8 +92,12 @@ func ExtractLinks(page *data.PageData, extractRoot bool) (res []*url.URL) {
 		return nil
 	}
 
-	// Set doc url
-	curUrl := util.ParseUrlEscaped(page.Url)
+	// Set doc url, links are relative to where redirects ended
+	docUrl := page.Url
+	if page.FinalUrl != "" {
+		docUrl = page.FinalUrl
+	}
+	curUrl := util.ParseUrlEscaped(docUrl)
 	if curUrl == nil {
 		log.Println("Error parsing doc url")
 		return nil
@@ -59,6 +110,13 @@ func ExtractLinks(page *data.PageData, extractRoot bool) (res []*url.URL) {
 		return val
 	})
 
+	// Redirect not followed by the downloader
+	if page.StatusCode >= 300 && page.StatusCode < 400 {
+		if loc := page.Header.Get("Location"); loc != "" {
+			urls = append(urls, loc)
+		}
+	}
+
 	// First push visited
 	// uInfo := NewUrlInfo(curUrl, true)
 	// res = append(res, uInfo)
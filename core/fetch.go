@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/jbrady42/crawl/data"
+)
+
+const defaultMaxRedirects = 10
+
+// Fetcher performs a single request for the download workers.
+// Redirects are returned as is and followed by the worker.
+// Fetchers are shared by all workers and must be safe for concurrent use.
+type Fetcher interface {
+	Fetch(req *http.Request) (*http.Response, error)
+}
+
+// FetcherFunc adapts a function to a Fetcher
+type FetcherFunc func(req *http.Request) (*http.Response, error)
+
+func (f FetcherFunc) Fetch(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Default fetcher over the worker http client
+type clientFetcher struct {
+	client *http.Client
+}
+
+func (t *clientFetcher) Fetch(req *http.Request) (*http.Response, error) {
+	if t.client.Jar != nil {
+		// The client adds jar cookies to the request, keep them off retries and redirects
+		req = req.Clone(req.Context())
+	}
+	return t.client.Do(req)
+}
+
+// Fetch following redirects like http.Client, recording each hop.
+// Redirects not followed are returned as the response.
+func (t *DownloadWorker) fetchFollow(req *http.Request) (*http.Response, []data.Redirect, error) {
+	var hops []data.Redirect
+
+	for {
+		t.crawler.setUserAgent(req)
+		if err := t.crawler.runRequestHooks(req, t.currentInfo); err != nil {
+			return nil, hops, err
+		}
+		resp, err := t.fetcher.Fetch(req)
+		if err != nil {
+			return nil, hops, err
+		}
+		if resp.Request == nil {
+			resp.Request = req
+		}
+		loc := redirectLocation(resp)
+		if loc == nil {
+			return resp, hops, nil
+		}
+		hops = append(hops, data.Redirect{
+			Url:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Location:   loc.String(),
+		})
+
+		if t.crawler.MaxRedirects == 0 {
+			return resp, hops, nil
+		}
+		if t.crawler.StayOnHost && loc.Hostname() != req.URL.Hostname() {
+			log.Println("Not following redirect to", loc)
+			return resp, hops, nil
+		}
+		resp.Body.Close()
+
+		if len(hops) > t.crawler.MaxRedirects {
+			err := fmt.Errorf("stopped after %d redirects", t.crawler.MaxRedirects)
+			return nil, hops, &url.Error{Op: "Get", URL: loc.String(), Err: err}
+		}
+		req = t.crawler.redirectRequest(req, loc)
+		// Each hop is a request to its host
+		t.waitForHost(req.Context(), req.URL)
+	}
+}
+
+// Location of a redirect response, nil if not a redirect
+func redirectLocation(resp *http.Response) *url.URL {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil
+	}
+	loc, err := resp.Location()
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+func (t *Crawler) redirectRequest(req *http.Request, loc *url.URL) *http.Request {
+	next := req.Clone(req.Context())
+	next.URL = loc
+	next.Host = ""
+	// Do not leak credentials to other hosts, their profile sets its own
+	if loc.Hostname() != req.URL.Hostname() {
+		next.Header.Del("Authorization")
+		next.Header.Del("Cookie")
+		for _, name := range t.secretHeaders {
+			next.Header.Del(name)
+		}
+	}
+	return next
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"net/http"
+
+	"github.com/jbrady42/crawl/data"
+)
+
+// RequestHook runs before each page request, including redirects.
+// It may change the request or return an error to veto the url.
+type RequestHook func(req *http.Request, info *DownloadInfo) error
+
+// ResultHook runs on each page result before output.
+// It may change the result or return nil to drop it.
+type ResultHook func(page *data.PageResult, info *DownloadInfo) *data.PageResult
+
+func (t *Crawler) AddRequestHook(hook RequestHook) {
+	t.requestHooks = append(t.requestHooks, hook)
+}
+
+func (t *Crawler) AddResultHook(hook ResultHook) {
+	t.resultHooks = append(t.resultHooks, hook)
+}
+
+func (t *Crawler) runRequestHooks(req *http.Request, info *DownloadInfo) error {
+	for _, hook := range t.requestHooks {
+		if err := hook(req, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Crawler) runResultHooks(page *data.PageResult, info *DownloadInfo) *data.PageResult {
+	for _, hook := range t.resultHooks {
+		if page = hook(page, info); page == nil {
+			return nil
+		}
+	}
+	return page
+}
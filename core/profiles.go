@@ -0,0 +1,85 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/jbrady42/crawl/data"
+)
+
+// Request settings for hosts matching one of Hosts, globs like *.example.com.
+// Username sends basic auth, Token sends a bearer token.
+type HostProfile struct {
+	Hosts    []string
+	Headers  map[string]string
+	Username string
+	Password string
+	Token    string
+}
+
+// LoadHostProfiles reads a JSON list of profiles
+func LoadHostProfiles(path string) ([]HostProfile, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []HostProfile
+	if err := json.Unmarshal(text, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+func (t *HostProfile) matches(host string) bool {
+	for _, pattern := range t.Hosts {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *HostProfile) apply(req *http.Request) {
+	for name, value := range t.Headers {
+		req.Header.Set(name, value)
+	}
+	switch {
+	case t.Token != "":
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	case t.Username != "":
+		req.SetBasicAuth(t.Username, t.Password)
+	}
+}
+
+// AddHostProfiles applies the first matching profile to each request,
+// redirects included. Profile headers are left out of page data.
+func (t *Crawler) AddHostProfiles(profiles []HostProfile) {
+	for _, profile := range profiles {
+		for name := range profile.Headers {
+			t.secretHeaders = append(t.secretHeaders, name)
+		}
+	}
+	t.AddRequestHook(func(req *http.Request, info *DownloadInfo) error {
+		host := strings.ToLower(req.URL.Hostname())
+		for i := range profiles {
+			if profiles[i].matches(host) {
+				profiles[i].apply(req)
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// Drop headers set from profiles, they may hold keys
+func (t *Crawler) redactHeaders(page *data.PageResult) {
+	if page.Data == nil || page.Data.RequestHeader == nil {
+		return
+	}
+	for _, name := range t.secretHeaders {
+		page.Data.RequestHeader.Del(name)
+	}
+}
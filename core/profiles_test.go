@@ -0,0 +1,61 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestProfileHeadersNotSentAcrossHosts(t *testing.T) {
+	var got http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer other.Close()
+	otherUrl, _ := url.Parse(other.URL)
+	target := "http://localhost:" + otherUrl.Port() + "/"
+
+	start := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			t.Error("profile header not sent to its host")
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+	}))
+	defer start.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	crawler := NewCrawler(1, false, nil)
+	crawler.Fetcher = FetcherFunc(client.Do)
+	crawler.AddHostProfiles([]HostProfile{{
+		Hosts:   []string{"127.0.0.1"},
+		Headers: map[string]string{"X-Api-Key": "secret"},
+		Token:   "token",
+	}})
+
+	worker := crawler.newDownloadWorker()
+	worker.currentInfo = newDownloadInfo(start.URL)
+	req, _ := http.NewRequest("GET", start.URL, nil)
+	resp, hops, err := worker.fetchFollow(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if len(hops) != 1 || !strings.HasPrefix(hops[0].Location, target) {
+		t.Fatalf("redirects %v, want one to %s", hops, target)
+	}
+	if got == nil {
+		t.Fatal("redirect not followed")
+	}
+	for _, name := range []string{"X-Api-Key", "Authorization"} {
+		if v := got.Get(name); v != "" {
+			t.Errorf("%s = %q sent to other host", name, v)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// Proxy for hosts matching Pattern, nil Proxy connects directly
+type ProxyRule struct {
+	Pattern string
+	Proxy   *url.URL
+}
+
+// ParseProxy checks a proxy url is one the transport can use
+func ParseProxy(str string) (*url.URL, error) {
+	proxy, err := url.Parse(str)
+	if err != nil {
+		return nil, err
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+	}
+	if proxy.Host == "" {
+		return nil, fmt.Errorf("proxy without host %q", str)
+	}
+	return proxy, nil
+}
+
+// LoadProxyRules reads lines of host pattern and proxy url or direct.
+// Patterns are globs like *.example.com, the first match is used.
+func LoadProxyRules(filename string) ([]ProxyRule, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules []ProxyRule
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected pattern and proxy", filename, lineNum)
+		}
+		if _, err := path.Match(fields[0], ""); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, lineNum, err)
+		}
+
+		rule := ProxyRule{Pattern: strings.ToLower(fields[0])}
+		if fields[1] != "direct" {
+			if rule.Proxy, err = ParseProxy(fields[1]); err != nil {
+				return nil, fmt.Errorf("%s:%d: %s", filename, lineNum, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// Proxy for a request. The proxy resolves the target host,
+// so the dialer only sees the proxy address and skips ip pinning.
+func (t *Crawler) proxyFor(req *http.Request) (*url.URL, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	for _, rule := range t.ProxyRules {
+		if ok, _ := path.Match(rule.Pattern, host); ok {
+			return rule.Proxy, nil
+		}
+	}
+	if t.Proxy != nil {
+		return t.Proxy, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// Address the response came from, nil through a proxy
+// since the connection was to the proxy, not the host.
+func (t *Crawler) responseIP(resp *http.Response, timer *requestTimer) net.IP {
+	if proxy, _ := t.proxyFor(resp.Request); proxy != nil {
+		return nil
+	}
+	return timer.ip()
+}
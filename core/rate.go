@@ -0,0 +1,64 @@
+package core
+
+import (
+	"io"
+	"sync"
+
+	"github.com/juju/ratelimit"
+)
+
+const bytesPerMB = 1024 * 1024
+
+// Limit total download bandwidth across all workers
+func (t *Crawler) SetRateLimited(mb float64) {
+	t.RateLimitMB = mb
+	t.RateBucket = newRateBucket(mb)
+}
+
+// Limit download bandwidth for each host
+func (t *Crawler) SetHostRateLimited(mb float64) {
+	t.HostRateLimitMB = mb
+	t.hostBuckets = nil
+	if mb > 0 {
+		t.hostBuckets = &hostBuckets{mb: mb, buckets: make(map[string]*ratelimit.Bucket)}
+	}
+}
+
+func newRateBucket(mb float64) *ratelimit.Bucket {
+	if mb <= 0 {
+		return nil
+	}
+	rate := mb * bytesPerMB
+	// Allow bursts of up to a second
+	return ratelimit.NewBucketWithRate(rate, int64(rate))
+}
+
+type hostBuckets struct {
+	mu      sync.Mutex
+	mb      float64
+	buckets map[string]*ratelimit.Bucket
+}
+
+func (t *hostBuckets) get(host string) *ratelimit.Bucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	bucket, ok := t.buckets[host]
+	if !ok {
+		bucket = newRateBucket(t.mb)
+		t.buckets[host] = bucket
+	}
+	return bucket
+}
+
+// Wrap a body reader in the global and host buckets
+func (t *Crawler) rateLimited(r io.Reader, host string) io.Reader {
+	if t.RateBucket != nil {
+		r = ratelimit.Reader(r, t.RateBucket)
+	}
+	if t.hostBuckets != nil {
+		if bucket := t.hostBuckets.get(host); bucket != nil {
+			r = ratelimit.Reader(r, bucket)
+		}
+	}
+	return r
+}
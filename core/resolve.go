@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"log"
 	"sync"
 	"time"
@@ -10,6 +11,10 @@ import (
 )
 
 func (t *Crawler) ResolveWorker(inQ <-chan string, outQ chan<- *data.ResolveResult) {
+	t.ResolveWorkerContext(context.Background(), inQ, outQ)
+}
+
+func (t *Crawler) ResolveWorkerContext(ctx context.Context, inQ <-chan string, outQ chan<- *data.ResolveResult) {
 	var wg sync.WaitGroup
 	wg.Add(t.WorkerCount)
 	for i := 0; i < t.WorkerCount; i++ {
@@ -17,7 +22,7 @@ func (t *Crawler) ResolveWorker(inQ <-chan string, outQ chan<- *data.ResolveResu
 
 		go func(i int) {
 			defer wg.Done()
-			t.resolveWorker(inQ, outQ)
+			t.resolveWorker(ctx, inQ, outQ)
 			log.Println("Closing worker ", i)
 		}(i)
 	}
@@ -25,16 +30,27 @@ func (t *Crawler) ResolveWorker(inQ <-chan string, outQ chan<- *data.ResolveResu
 	wg.Wait()
 }
 
-func (t *Crawler) resolveWorker(inQ <-chan string, outQ chan<- *data.ResolveResult) {
+func (t *Crawler) resolveWorker(ctx context.Context, inQ <-chan string, outQ chan<- *data.ResolveResult) {
 	resolveWorker := t.Resolver.NewWorker()
 
-	for urlStr := range inQ {
+	for {
+		var urlStr string
+		select {
+		case s, ok := <-inQ:
+			if !ok {
+				return
+			}
+			urlStr = s
+		case <-ctx.Done():
+			return
+		}
+
 		url := util.ParseUrl(urlStr)
-		host := url.Host
+		host := url.Hostname()
 
 		var res *data.ResolveResult
 
-		resolved, cname, err := resolveWorker.Resolve(host)
+		resolved, cname, err := resolveWorker.ResolveAllContext(ctx, host)
 		if err != nil {
 			res = data.NewErrorResolveResult(urlStr, err)
 			log.Println(err.Error(), urlStr)
@@ -42,6 +58,10 @@ func (t *Crawler) resolveWorker(inQ <-chan string, outQ chan<- *data.ResolveResu
 			res = data.NewResolveResult(urlStr, resolved, cname)
 			log.Println("Resolved:", urlStr)
 		}
-		outQ <- res
+		select {
+		case outQ <- res:
+		case <-ctx.Done():
+			return
+		}
 	}
 }
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryDelay    = 1 * time.Second
+	defaultMaxRetryDelay = 30 * time.Second
+)
+
+// RetryPolicy controls retrying of transient download failures.
+// Connection resets, timeouts, 429 and 5xx responses are retried.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func NewRetryPolicy(attempts int) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: attempts,
+		BaseDelay:   defaultRetryDelay,
+		MaxDelay:    defaultMaxRetryDelay,
+	}
+}
+
+// Returns the wait before the next attempt and if one should be made
+func (t *RetryPolicy) next(attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if t == nil || attempt >= t.MaxAttempts {
+		return 0, false
+	}
+
+	var retryAfter time.Duration
+	if err != nil {
+		if !retryableError(err) {
+			return 0, false
+		}
+	} else if resp != nil {
+		if !retryableStatus(resp.StatusCode) {
+			return 0, false
+		}
+		retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	}
+
+	// Server wants longer than we are willing to wait
+	if retryAfter > t.MaxDelay {
+		return 0, false
+	}
+
+	wait := t.backoff(attempt)
+	if retryAfter > wait {
+		wait = retryAfter
+	}
+	return wait, true
+}
+
+// Exponential backoff with jitter in the upper half
+func (t *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := t.BaseDelay
+	for i := 1; i < attempt && delay < t.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > t.MaxDelay {
+		delay = t.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+func retryableError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// Retry-After is either seconds or an http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
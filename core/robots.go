@@ -0,0 +1,261 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/jbrady42/crawl/data"
+	"github.com/jbrady42/crawl/util"
+	"github.com/temoto/robotstxt-go"
+)
+
+const (
+	robotsTTL          = 24 * time.Hour
+	robotsRetryTTL     = 10 * time.Minute
+	robotsMaxRedirects = 5
+	robotsMaxBytes     = 512 * 1024
+	robotsCacheSize    = 500
+)
+
+var errRobotsRedirects = errors.New("too many robots redirects")
+
+type robotsEntry struct {
+	robots *robotstxt.RobotsData
+	status int
+	body   string
+	// Server error or unreachable, disallow until expired
+	unavailable bool
+	expiresAt   time.Time
+}
+
+func newRobotsEntry(status int, body string, expiresAt time.Time) *robotsEntry {
+	entry := &robotsEntry{
+		status:      status,
+		body:        body,
+		unavailable: status >= 500,
+		expiresAt:   expiresAt,
+	}
+
+	robots, err := robotstxt.FromStatusAndString(status, body)
+	if err != nil {
+		// Unparseable rules allow all
+		log.Println("Robots error: ", err)
+		robots, _ = robotstxt.FromStatusAndString(http.StatusNotFound, "")
+	}
+	entry.robots = robots
+	return entry
+}
+
+func (t *robotsEntry) expired() bool {
+	return t.expiresAt.Before(time.Now())
+}
+
+// Robots results by robots url, expired by outcome
+type robotsCache struct {
+	items *lru.Cache
+}
+
+func newRobotsCache() *robotsCache {
+	items, _ := lru.New(robotsCacheSize)
+	return &robotsCache{items: items}
+}
+
+func (t *robotsCache) get(key string) (*robotsEntry, bool) {
+	item, ok := t.items.Get(key)
+	if !ok {
+		return nil, false
+	}
+	entry := item.(*robotsEntry)
+	if entry.expired() {
+		t.items.Remove(key)
+		return nil, false
+	}
+	return entry, true
+}
+
+func (t *robotsCache) add(key string, entry *robotsEntry) {
+	t.items.Add(key, entry)
+}
+
+func (t *DownloadWorker) robotsTxt(ctx context.Context, inUrl *url.URL) *robotstxt.RobotsData {
+	return t.robotsEntry(ctx, inUrl).robots
+}
+
+func (t *DownloadWorker) robotsEntry(ctx context.Context, inUrl *url.URL) *robotsEntry {
+	roboUrl := util.RobotsUrl(inUrl).String()
+
+	entry, ok := t.crawler.robotsCache.get(roboUrl)
+	if ok {
+		return entry
+	}
+	// Then disk
+	if dir := t.crawler.RobotsCacheDir; dir != "" {
+		if stored := loadRobots(dir, roboUrl); stored != nil {
+			entry = newRobotsEntry(stored.Status, stored.Body, stored.ExpiresAt)
+		}
+	}
+	if entry == nil {
+		entry = t.fetchRobots(ctx, roboUrl)
+	}
+	// Cancelled fetches say nothing about the host
+	if ctx.Err() == nil {
+		t.crawler.robotsCache.add(roboUrl, entry)
+	}
+	return entry
+}
+
+// Fetch and interpret robots by response status. 2xx parses the rules,
+// 4xx allows all, 5xx or unreachable disallows all until retried.
+func (t *DownloadWorker) fetchRobots(ctx context.Context, roboUrl string) *robotsEntry {
+	status, body, err := t.getRobots(ctx, roboUrl)
+
+	switch {
+	case err == errRobotsRedirects:
+		// Treated as unavailable
+		log.Println("Robots redirects exceeded:", roboUrl)
+		status = http.StatusNotFound
+	case err != nil:
+		log.Println("Robots unreachable:", roboUrl, err)
+		status = http.StatusServiceUnavailable
+	case status >= 300 && status < 400:
+		// Redirect without location
+		status = http.StatusNotFound
+	}
+
+	expiresAt := time.Now().Add(robotsTTL)
+	if status >= 500 {
+		expiresAt = time.Now().Add(robotsRetryTTL)
+	}
+
+	if dir := t.crawler.RobotsCacheDir; dir != "" && ctx.Err() == nil {
+		saveRobots(dir, &storedRobots{roboUrl, status, body, expiresAt})
+	}
+	return newRobotsEntry(status, body, expiresAt)
+}
+
+// Get robots following up to robotsMaxRedirects hops
+func (t *DownloadWorker) getRobots(ctx context.Context, roboUrl string) (status int, body string, err error) {
+	next, err := url.Parse(roboUrl)
+	if err != nil {
+		return 0, "", err
+	}
+
+	for hop := 0; hop <= robotsMaxRedirects; hop++ {
+		req, err := http.NewRequestWithContext(ctx, "GET", next.String(), nil)
+		if err != nil {
+			return 0, "", err
+		}
+		t.crawler.setUserAgent(req)
+		resp, err := t.fetcher.Fetch(req)
+		if err != nil {
+			return 0, "", err
+		}
+
+		if loc := redirectLocation(resp); loc != nil {
+			resp.Body.Close()
+			next = loc
+			continue
+		}
+
+		var text []byte
+		if resp.StatusCode < 300 {
+			body := t.crawler.rateLimited(resp.Body, next.Host)
+			text, err = ioutil.ReadAll(io.LimitReader(body, robotsMaxBytes))
+		}
+		resp.Body.Close()
+		if err != nil {
+			return 0, "", err
+		}
+		return resp.StatusCode, string(text), nil
+	}
+	return 0, "", errRobotsRedirects
+}
+
+func (t *DownloadWorker) allowedByRobots(ctx context.Context, inUrl string) (allowed bool, reason string) {
+	robotsUrl, _ := url.Parse(inUrl)
+	// Fetch robots
+	entry := t.robotsEntry(ctx, robotsUrl)
+	if entry.unavailable {
+		return false, "Robots unavailable"
+	}
+	allowed = entry.robots.TestAgent(robotsUrl.Path, t.crawler.UserAgent)
+	if !allowed {
+		return false, "Blocked by robots"
+	}
+	return true, ""
+}
+
+// Check urls against robots without downloading them
+func (t *Crawler) RobotsCheck(inQ <-chan string, outQ chan<- *data.RobotsResult) {
+	t.RobotsCheckContext(context.Background(), inQ, outQ)
+}
+
+func (t *Crawler) RobotsCheckContext(ctx context.Context, inQ <-chan string, outQ chan<- *data.RobotsResult) {
+	var wg sync.WaitGroup
+	wg.Add(t.WorkerCount)
+	for i := 0; i < t.WorkerCount; i++ {
+		go func() {
+			defer wg.Done()
+			worker := t.newDownloadWorker()
+			for {
+				var s string
+				select {
+				case in, ok := <-inQ:
+					if !ok {
+						return
+					}
+					s = in
+				case <-ctx.Done():
+					return
+				}
+
+				res := worker.checkRobots(ctx, newDownloadInfo(s))
+				select {
+				case outQ <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (t *DownloadWorker) checkRobots(ctx context.Context, info *DownloadInfo) *data.RobotsResult {
+	// Set info for dialer
+	t.currentInfo = info
+	res := &data.RobotsResult{Url: info.Url}
+
+	inUrl, err := url.Parse(info.Url)
+	if err != nil || inUrl.Host == "" {
+		res.Message = "Bad url"
+		return res
+	}
+
+	var reason string
+	res.Allowed, reason = t.allowedByRobots(ctx, info.Url)
+	res.Message = reason
+
+	entry := t.robotsEntry(ctx, inUrl)
+	switch {
+	case entry.unavailable:
+		// Reason already says so
+	case entry.status < 200 || entry.status >= 300:
+		res.Message = "No robots, status " + strconv.Itoa(entry.status)
+	default:
+		res.Agent, res.Rule, _ = matchRobotsRule(entry.body, t.crawler.UserAgent, inUrl.Path)
+		if group := entry.robots.FindGroup(t.crawler.UserAgent); group != nil {
+			res.CrawlDelay = group.CrawlDelay
+		}
+	}
+	return res
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+// A robots rule kept for explaining decisions
+type robotsRule struct {
+	line    string
+	path    string
+	allow   bool
+	pattern *regexp.Regexp
+}
+
+// Find the user agent group and rule that decide path, following the
+// same grouping and precedence as the robotstxt package. Like it, patterns
+// may match anywhere in the path. Empty strings if none apply,
+// allowed is the decision either way.
+func matchRobotsRule(body, agent, path string) (group, rule string, allowed bool) {
+	groups := parseRobotsRules(body)
+
+	// Most specific agent wins
+	agent = strings.ToLower(agent)
+	var rules []*robotsRule
+	var prefixLen int
+	if r, ok := groups["*"]; ok {
+		group, rules, prefixLen = "*", r, 1
+	}
+	for a, r := range groups {
+		if a != "*" && strings.HasPrefix(agent, a) && len(a) > prefixLen {
+			group, rules, prefixLen = a, r, len(a)
+		}
+	}
+
+	// Then longest matching path
+	var match *robotsRule
+	prefixLen = 0
+	for _, r := range rules {
+		switch {
+		case r.pattern != nil:
+			if r.pattern.MatchString(path) && len(r.pattern.String()) > prefixLen {
+				match, prefixLen = r, len(r.pattern.String())
+			}
+		case r.path == "/" && prefixLen == 0:
+			match, prefixLen = r, 1
+		case strings.HasPrefix(path, r.path) && len(r.path) > prefixLen:
+			match, prefixLen = r, len(r.path)
+		}
+	}
+	if match == nil {
+		return group, "", true
+	}
+	return group, match.line, match.allow
+}
+
+func parseRobotsRules(body string) map[string][]*robotsRule {
+	groups := make(map[string][]*robotsRule)
+	var agents []string
+	inRules := false
+
+	scan := bufio.NewScanner(strings.NewReader(body))
+	for scan.Scan() {
+		line := scan.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "user-agent", "useragent":
+			if value == "" {
+				continue
+			}
+			// Successive agents share a group
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			if len(agents) == 0 {
+				continue
+			}
+			// An empty rule is ignored but still ends the group
+			inRules = true
+			if value == "" {
+				continue
+			}
+			rule := newRobotsRule(strings.TrimSpace(line), value, key == "allow")
+			for _, a := range agents {
+				groups[a] = append(groups[a], rule)
+			}
+		case "crawl-delay", "crawldelay":
+			inRules = true
+		}
+	}
+	return groups
+}
+
+func newRobotsRule(line, path string, allow bool) *robotsRule {
+	if !strings.HasPrefix(path, "*") && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	path = strings.TrimRight(path, "*")
+
+	rule := &robotsRule{line: line, path: path, allow: allow}
+	if strings.ContainsAny(path, "*$") {
+		expr := regexp.QuoteMeta(path)
+		expr = strings.Replace(expr, `\*`, `.*`, -1)
+		expr = strings.Replace(expr, `\$`, `$`, -1)
+		rule.pattern, _ = regexp.Compile(expr)
+	}
+	return rule
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/temoto/robotstxt-go"
+)
+
+func TestMatchRobotsRule(t *testing.T) {
+	tests := []struct {
+		body  string
+		agent string
+		path  string
+	}{
+		{"User-agent: *\nDisallow: /private\n", "crawl", "/private/a"},
+		{"User-agent: *\nDisallow: /private\n", "crawl", "/public"},
+		{"User-agent: *\nDisallow: /\nAllow: /public\n", "crawl", "/public/a"},
+		{"User-agent: *\nDisallow: /\nUser-agent: crawl\nAllow: /\n", "crawl/1.0", "/a"},
+		{"User-agent: a\nUser-agent: b\nDisallow: /\n", "a", "/x"},
+		{"User-agent: a\nDisallow:\nUser-agent: b\nDisallow: /\n", "a", "/x"},
+		{"User-agent: a\nDisallow:\nUser-agent: b\nDisallow: /\n", "b", "/x"},
+		{"User-agent: a\nAllow:\nUser-agent: b\nDisallow: /\n", "a", "/x"},
+		{"User-agent: a\nCrawl-delay: 1\nUser-agent: b\nDisallow: /\n", "a", "/x"},
+		{"User-agent: a\nCrawldelay: 1\nUser-agent: b\nDisallow: /\n", "a", "/x"},
+		{"User-agent: a\nSitemap: http://x/s\nUser-agent: b\nDisallow: /\n", "a", "/x"},
+		{"User-agent: a\nUser-agent:\nDisallow: /\n", "a", "/x"},
+		{"User-agent: *\nDisallow: /*.php$\n", "crawl", "/a/b.php"},
+		{"User-agent: *\nDisallow: /*.php$\n", "crawl", "/a/b.php?x=1"},
+		{"User-agent: *\nDisallow: /private$\n", "crawl", "/a/private"},
+		{"User-agent: *\nDisallow: *private\n", "crawl", "/a/private"},
+		{"User-agent: *\nDisallow: /a\nAllow: /*b\n", "crawl", "/ab"},
+		{"User-agent: *\nDisallow: /abc\nAllow: /*b\n", "crawl", "/abc"},
+		{"User-agent: *\nDisallow: /\nAllow: /$\n", "crawl", "/"},
+		{"User-agent: *\nDisallow: private # comment\n", "crawl", "/private"},
+	}
+
+	for _, test := range tests {
+		robots, err := robotstxt.FromString(test.body)
+		if err != nil {
+			t.Fatalf("%q: %v", test.body, err)
+		}
+		want := robots.TestAgent(test.path, test.agent)
+
+		_, rule, got := matchRobotsRule(test.body, test.agent, test.path)
+		if got != want {
+			t.Errorf("%q agent %s path %s: rule %q allows %v, robotstxt %v",
+				test.body, test.agent, test.path, rule, got, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jbrady42/crawl/util"
+)
+
+// Robots result as kept on disk, one file per host
+type storedRobots struct {
+	Url       string
+	Status    int
+	Body      string
+	ExpiresAt time.Time
+}
+
+func robotsPath(dir, roboUrl string) string {
+	name := roboUrl
+	if u, err := url.Parse(roboUrl); err == nil {
+		name = u.Scheme + "_" + u.Host
+	}
+	// Keep names filesystem safe
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+	return filepath.Join(dir, name+".json")
+}
+
+// Returns nil if missing, unreadable or expired
+func loadRobots(dir, roboUrl string) *storedRobots {
+	text, err := ioutil.ReadFile(robotsPath(dir, roboUrl))
+	if err != nil {
+		return nil
+	}
+	var stored storedRobots
+	if err := json.Unmarshal(text, &stored); err != nil {
+		log.Println("Error reading cached robots:", err)
+		return nil
+	}
+	if stored.Url != roboUrl || stored.ExpiresAt.Before(time.Now()) {
+		return nil
+	}
+	return &stored
+}
+
+func saveRobots(dir string, stored *storedRobots) {
+	text, err := json.Marshal(stored)
+	if err != nil {
+		log.Println("Error preparing robots cache")
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Println("Can not create robots cache dir:", err)
+		return
+	}
+
+	if err := util.WriteFileAtomic(robotsPath(dir, stored.Url), text, 0644); err != nil {
+		log.Println("Can not write robots cache:", err)
+	}
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCrawlDelay    = 1 * time.Second
+	defaultMaxCrawlDelay = 30 * time.Second
+	throttlePruneSize    = 10000
+)
+
+// Spaces out requests to the same host across all workers
+type hostThrottle struct {
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+func newHostThrottle() *hostThrottle {
+	return &hostThrottle{next: make(map[string]time.Time)}
+}
+
+// Reserve the next slot for host and sleep until it
+func (t *hostThrottle) wait(ctx context.Context, host string, delay time.Duration) {
+	t.mu.Lock()
+	now := time.Now()
+	if len(t.next) > throttlePruneSize {
+		t.prune(now)
+	}
+	at := t.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	t.next[host] = at.Add(delay)
+	t.mu.Unlock()
+
+	sleepContext(ctx, at.Sub(now))
+}
+
+// Drop hosts that are free again
+func (t *hostThrottle) prune(now time.Time) {
+	for host, at := range t.next {
+		if at.Before(now) {
+			delete(t.next, host)
+		}
+	}
+}
+
+// Crawl delay for a url from robots, clamped to the crawler limits
+func (t *DownloadWorker) crawlDelay(ctx context.Context, inUrl *url.URL) time.Duration {
+	delay := t.crawler.MinCrawlDelay
+
+	if !t.crawler.IgnoreRobots {
+		if robots := t.robotsTxt(ctx, inUrl); robots != nil {
+			group := robots.FindGroup(t.crawler.UserAgent)
+			if group != nil && group.CrawlDelay > delay {
+				delay = group.CrawlDelay
+			}
+		}
+	}
+
+	if max := t.crawler.MaxCrawlDelay; max > 0 && delay > max {
+		log.Println("Capping crawl delay for", inUrl.Host, delay)
+		delay = max
+	}
+	return delay
+}
+
+func (t *DownloadWorker) waitForHost(ctx context.Context, inUrl *url.URL) {
+	if inUrl == nil {
+		return
+	}
+	t.crawler.throttle.wait(ctx, inUrl.Host, t.crawlDelay(ctx, inUrl))
+}
+
+// Returns false if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
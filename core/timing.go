@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/jbrady42/crawl/data"
+)
+
+// Collects phase timings for one fetch, across redirects
+type requestTimer struct {
+	mu        sync.Mutex
+	start     time.Time
+	hopStart  time.Time
+	dnsStart  time.Time
+	connStart map[string]time.Time
+	connDone  map[string]time.Duration
+	tlsStart  time.Time
+	timing    data.Timing
+	remoteIP  net.IP
+}
+
+func newRequestTimer() *requestTimer {
+	now := time.Now()
+	return &requestTimer{
+		start:     now,
+		hopStart:  now,
+		connStart: make(map[string]time.Time),
+		connDone:  make(map[string]time.Duration),
+	}
+}
+
+func (t *requestTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			t.mu.Lock()
+			t.hopStart = time.Now()
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+				t.remoteIP = addr.IP
+			}
+			// Only the dial that won counts, parallel attempts overlap
+			if !info.Reused {
+				t.timing.Connect += t.connDone[info.Conn.RemoteAddr().String()]
+			}
+			t.connDone = make(map[string]time.Duration)
+			t.mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.timing.DNS += time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			t.mu.Lock()
+			t.connStart[addr] = time.Now()
+			t.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mu.Lock()
+			if start, ok := t.connStart[addr]; ok && err == nil {
+				t.connDone[addr] = time.Since(start)
+			}
+			delete(t.connStart, addr)
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.timing.TLS += time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			// Of the last hop
+			t.timing.TTFB = time.Since(t.hopStart)
+			t.mu.Unlock()
+		},
+	}
+}
+
+func (t *requestTimer) withTrace(req *http.Request) *http.Request {
+	ctx := httptrace.WithClientTrace(req.Context(), t.trace())
+	return req.WithContext(ctx)
+}
+
+// Address of the last connection, new or reused
+func (t *requestTimer) ip() net.IP {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remoteIP
+}
+
+// Timings so far, total is since the fetch started
+func (t *requestTimer) done() *data.Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timing := t.timing
+	timing.Total = time.Since(t.start)
+	return &timing
+}
+
+// Report lookups done by the dialer, the transport only sees ip addresses
+func traceDNS(ctx context.Context, host string, lookup func() error) error {
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	err := lookup()
+	if trace != nil && trace.DNSDone != nil {
+		trace.DNSDone(httptrace.DNSDoneInfo{Err: err})
+	}
+	return err
+}
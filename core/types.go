@@ -2,7 +2,10 @@ package core
 
 import (
 	"net"
+	"net/url"
 	"strings"
+
+	"github.com/jbrady42/crawl/data"
 )
 
 type Page struct {
@@ -20,21 +23,76 @@ type CrawlOpts struct {
 type DownloadInfo struct {
 	Url string
 	IP  net.IP
+
+	// Validators from a previous fetch
+	ETag         string
+	LastModified string
 }
 
+// Input lines are either tab separated "url [ip [etag [last-modified]]]"
+// or page result JSON from a previous download
 func newDownloadInfo(s string) *DownloadInfo {
-	var ip net.IP
-	var urlStr string
+	if strings.HasPrefix(s, "{") {
+		return downloadInfoFromPage(data.PageDataFromLine(s))
+	}
 
 	parts := strings.Split(s, "\t")
-	if len(parts) == 2 {
-		ip = net.ParseIP(parts[1])
-		urlStr = parts[0]
-	} else {
-		urlStr = s
+	info := &DownloadInfo{Url: parts[0]}
+	if len(parts) > 1 {
+		info.IP = net.ParseIP(parts[1])
+	}
+	if len(parts) > 2 {
+		info.ETag = parts[2]
+	}
+	if len(parts) > 3 {
+		info.LastModified = parts[3]
 	}
 
-	return &DownloadInfo{Url: urlStr, IP: ip}
+	return info
+}
+
+func (t *DownloadInfo) isHost(host string) bool {
+	u, err := url.Parse(t.Url)
+	if err != nil {
+		return false
+	}
+	return u.Hostname() == host
+}
+
+func downloadInfoFromPage(page *data.PageResult) *DownloadInfo {
+	info := &DownloadInfo{}
+	if page.Data == nil {
+		return info
+	}
+	info.Url = page.Data.Url
+	// The ip is of the last hop, only pin it for the same host
+	if stayedOnHost(page.Data) {
+		info.IP = page.Data.IP
+	}
+	if page.Data.Header != nil {
+		info.ETag = page.Data.Header.Get("ETag")
+		info.LastModified = page.Data.Header.Get("Last-Modified")
+	}
+	return info
+}
+
+// Whether the final url and every redirect are on the starting host
+func stayedOnHost(pd *data.PageData) bool {
+	urls := []string{pd.FinalUrl}
+	for _, hop := range pd.Redirects {
+		urls = append(urls, hop.Url, hop.Location)
+	}
+	start := &DownloadInfo{Url: pd.Url}
+	for _, str := range urls {
+		if str == "" {
+			continue
+		}
+		u, err := url.Parse(str)
+		if err != nil || !start.isHost(u.Hostname()) {
+			return false
+		}
+	}
+	return true
 }
 
 type CrawlStats struct {
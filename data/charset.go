@@ -0,0 +1,93 @@
+package data
+
+import (
+	"bytes"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Decode text bodies to UTF-8.
+// Returns the body, the charset it was in, empty for non text,
+// and whether encoding the text again gives back the exact body.
+func decodeBody(body []byte, contentType string) (string, string, bool) {
+	if !isText(body, contentType) {
+		return string(body), "", false
+	}
+
+	enc, name, certain := charset.DetermineEncoding(body, contentType)
+	// Only the start is sniffed, a guess may miss later UTF-8
+	if !certain && name != "utf-8" && utf8.Valid(body) {
+		return string(body), "utf-8", true
+	}
+	if name == "utf-8" {
+		// Invalid sequences would be lost as JSON
+		return string(body), name, utf8.Valid(body)
+	}
+
+	text, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		log.Println("Error decoding", name, err)
+		return string(body), "", false
+	}
+	// Invalid bytes decode to replacement characters
+	exact := bytes.Equal(encodeBody(string(text), name), body)
+	return string(text), name, exact
+}
+
+// Decode a body in charset to UTF-8, replacing invalid bytes
+func decodeText(body []byte, name string) string {
+	if name == "" || name == "utf-8" {
+		return string(body)
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return string(body)
+	}
+	text, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return string(body)
+	}
+	return string(text)
+}
+
+// Encode a UTF-8 body back to its original charset
+func encodeBody(body string, name string) []byte {
+	if name == "" || name == "utf-8" {
+		return []byte(body)
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return []byte(body)
+	}
+	raw, err := enc.NewEncoder().Bytes([]byte(body))
+	if err != nil {
+		log.Println("Error encoding", name, err)
+		return []byte(body)
+	}
+	return raw
+}
+
+func isText(body []byte, contentType string) bool {
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, s := range []string{"html", "xml", "json", "javascript"} {
+		if strings.Contains(mediaType, s) {
+			return true
+		}
+	}
+	return false
+}
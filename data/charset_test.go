@@ -0,0 +1,50 @@
+package data
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPageBodyCharset(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		charset     string
+		encoding    string
+		text        string
+	}{
+		{"windows-1251", "text/html; charset=windows-1251",
+			[]byte("<p>\xcf\xf0\xe8\xe2\xe5\xf2</p>"), "windows-1251", "", "<p>Привет</p>"},
+		{"lossy shift_jis", "text/html; charset=shift_jis",
+			[]byte("<p>\x82\xa0\x82</p>"), "shift_jis", BodyBase64, "<p>あ"},
+		{"invalid utf-8", "text/html; charset=utf-8",
+			[]byte("<p>ok\xff\xfe</p>"), "utf-8", BodyBase64, "<p>ok"},
+		{"binary", "image/png",
+			[]byte("\x89PNG\r\n\x1a\n\x00\x00"), "", BodyBase64, ""},
+	}
+
+	for _, test := range tests {
+		resp := &http.Response{
+			Header: http.Header{"Content-Type": {test.contentType}},
+			Body:   ioutil.NopCloser(strings.NewReader("")),
+		}
+		page := NewPageData("http://example.com/", resp, test.body).Data
+
+		if page.Charset != test.charset {
+			t.Errorf("%s: charset %q, want %q", test.name, page.Charset, test.charset)
+		}
+		if page.BodyEncoding != test.encoding {
+			t.Errorf("%s: body encoding %q, want %q", test.name, page.BodyEncoding, test.encoding)
+		}
+		if got := page.BodyBytes(); !bytes.Equal(got, test.body) {
+			t.Errorf("%s: body bytes %q, want %q", test.name, got, test.body)
+		}
+		if text := page.Text(); !strings.HasPrefix(text, test.text) || (test.text == "" && text != "") {
+			t.Errorf("%s: text %q, want prefix %q", test.name, text, test.text)
+		}
+	}
+}
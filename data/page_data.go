@@ -1,36 +1,101 @@
 package data
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
+const timestampLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// Body encoding for content that is not text
+const BodyBase64 = "base64"
+
+// Request headers carrying credentials, never recorded
+var SecretHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
 type PageResult struct {
-	Data    *PageData
-	Success bool
-	Message string
+	Data        *PageData
+	Success     bool
+	NotModified bool
+	Message     string
+	SkipReason  string
 
-	Links []*url.URL
+	Links    []*url.URL
+	Attempts []Attempt
+	Tags     []string
 }
 
-type PageData struct {
+type Redirect struct {
 	Url        string
-	Body       string
+	StatusCode int
+	Location   string
+}
+
+// Request phase durations, summed over redirects.
+// TTFB is for the last request.
+type Timing struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	TTFB    time.Duration
+	Total   time.Duration
+}
+
+type Attempt struct {
 	Timestamp  string
-	Status     string
 	StatusCode int
-	Proto      string
-	Header     http.Header
-	Trailer    http.Header
+	Error      string
+	Wait       time.Duration
+}
+
+func NewAttempt(page *PageResult, err error, wait time.Duration) Attempt {
+	attempt := Attempt{
+		Timestamp:  page.Data.Timestamp,
+		StatusCode: page.Data.StatusCode,
+		Wait:       wait,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	return attempt
+}
+
+type PageData struct {
+	Url             string
+	FinalUrl        string
+	Redirects       []Redirect
+	IP              net.IP
+	Body            string
+	Charset         string
+	BodyEncoding    string
+	ContentEncoding string
+	WireBytes       int64
+	BytesRead       int64
+	ContentLength   int64
+	Truncated       bool
+	Timing          *Timing
+	TLS             *TLSInfo
+	Timestamp       string
+	Status          string
+	StatusCode      int
+	Proto           string
+	Header          http.Header
+	Trailer         http.Header
+	RequestHeader   http.Header
 }
 
 func NewPageData(url string, resp *http.Response, body []byte) *PageResult {
+	text, charset, exact := decodeBody(body, resp.Header.Get("Content-Type"))
 	pd := PageData{
 		Url:        url,
-		Body:       string(body),
+		Body:       text,
+		Charset:    charset,
 		Timestamp:  (time.Now()).String(),
 		Status:     resp.Status,
 		StatusCode: resp.StatusCode,
@@ -38,6 +103,23 @@ func NewPageData(url string, resp *http.Response, body []byte) *PageResult {
 		Header:     resp.Header,
 		Trailer:    resp.Trailer,
 	}
+	if !exact && len(body) > 0 {
+		// Not text or not convertible, keep exact bytes
+		pd.Body = base64.StdEncoding.EncodeToString(body)
+		pd.BodyEncoding = BodyBase64
+	}
+	if resp.TLS != nil {
+		pd.TLS = NewTLSInfo(resp.TLS)
+	}
+	if resp.Request != nil {
+		pd.RequestHeader = resp.Request.Header.Clone()
+		for _, name := range SecretHeaders {
+			pd.RequestHeader.Del(name)
+		}
+		if resp.Request.URL != nil {
+			pd.FinalUrl = resp.Request.URL.String()
+		}
+	}
 
 	fr := PageResult{
 		Data:    &pd,
@@ -67,6 +149,46 @@ func NewFailedResult(url string, reason string) *PageResult {
 	return &fr
 }
 
+// BodyBytes returns the body as it was served.
+func (t *PageData) BodyBytes() []byte {
+	if t.BodyEncoding == BodyBase64 {
+		raw, err := base64.StdEncoding.DecodeString(t.Body)
+		if err != nil {
+			log.Println("Error decoding body", err)
+			return nil
+		}
+		return raw
+	}
+	return encodeBody(t.Body, t.Charset)
+}
+
+// Text returns the body as UTF-8 for parsing, empty if it is not text.
+// Bytes invalid in the charset are replaced.
+func (t *PageData) Text() string {
+	if t.BodyEncoding != BodyBase64 {
+		return t.Body
+	}
+	if t.Charset == "" {
+		return ""
+	}
+	return decodeText(t.BodyBytes(), t.Charset)
+}
+
+// Time parses Timestamp back into a time.Time.
+// Returns the zero time if it can not be parsed.
+func (t *PageData) Time() time.Time {
+	str := t.Timestamp
+	// Drop monotonic clock reading
+	if i := strings.Index(str, " m="); i >= 0 {
+		str = str[:i]
+	}
+	ts, err := time.Parse(timestampLayout, str)
+	if err != nil {
+		return time.Time{}
+	}
+	return ts
+}
+
 func PageDataFromLine(line string) *PageResult {
 	var page PageResult
 
@@ -9,16 +9,17 @@ import (
 type ResolveResult struct {
 	Url     string
 	IP      net.IP
+	IPs     []net.IP
 	Cname   string
 	Message string
 }
 
 func NewErrorResolveResult(host string, err error) *ResolveResult {
-	return &ResolveResult{host, nil, "", err.Error()}
+	return &ResolveResult{host, nil, nil, "", err.Error()}
 }
 
-func NewResolveResult(host string, ip net.IP, cname string) *ResolveResult {
-	return &ResolveResult{host, ip, cname, ""}
+func NewResolveResult(host string, ips []net.IP, cname string) *ResolveResult {
+	return &ResolveResult{host, ips[0], ips, cname, ""}
 }
 
 func ResolveResultFromLine(line string) *ResolveResult {
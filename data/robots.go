@@ -0,0 +1,14 @@
+package data
+
+import (
+	"time"
+)
+
+type RobotsResult struct {
+	Url        string
+	Allowed    bool
+	Agent      string
+	Rule       string
+	CrawlDelay time.Duration
+	Message    string
+}
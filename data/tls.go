@@ -0,0 +1,44 @@
+package data
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+type TLSInfo struct {
+	Version     string
+	CipherSuite string
+	ALPN        string
+	ServerName  string
+	// Verification disabled with insecure
+	VerifySkipped bool
+	// Leaf first
+	Certificates []Certificate
+}
+
+type Certificate struct {
+	Subject   string
+	Issuer    string
+	DNSNames  []string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+func NewTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	info := TLSInfo{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		ServerName:  state.ServerName,
+	}
+	for _, cert := range state.PeerCertificates {
+		info.Certificates = append(info.Certificates, Certificate{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			DNSNames:  cert.DNSNames,
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+	return &info
+}
@@ -0,0 +1,36 @@
+package resolve
+
+import (
+	"errors"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// The dns_resolver client only asks for A records
+func lookupAAAA(servers []string, host string) ([]net.IP, error) {
+	client := new(dns.Client)
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(host), dns.TypeAAAA)
+
+	err := errors.New("No servers")
+	for _, server := range servers {
+		var in *dns.Msg
+		in, _, err = client.Exchange(msg, net.JoinHostPort(server, "53"))
+		if err != nil {
+			continue
+		}
+		if in.Rcode != dns.RcodeSuccess {
+			return nil, errors.New(dns.RcodeToString[in.Rcode])
+		}
+
+		var ips []net.IP
+		for _, rr := range in.Answer {
+			if record, ok := rr.(*dns.AAAA); ok {
+				ips = append(ips, record.AAAA)
+			}
+		}
+		return ips, nil
+	}
+	return nil, err
+}
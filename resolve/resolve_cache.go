@@ -9,7 +9,7 @@ const cacheTTL = 20 * time.Minute
 
 type cacheItem struct {
 	host      string
-	ip        net.IP
+	ips       []net.IP
 	cname     string
 	expiresAt time.Time
 }
@@ -18,10 +18,10 @@ func (t *cacheItem) expired() bool {
 	return t.expiresAt.Before(time.Now())
 }
 
-func newCacheItem(host, cname string, ip net.IP) *cacheItem {
+func newCacheItem(host, cname string, ips []net.IP) *cacheItem {
 	item := &cacheItem{
 		host:      host,
-		ip:        ip,
+		ips:       ips,
 		cname:     cname,
 		expiresAt: time.Now().Add(cacheTTL),
 	}
@@ -1,6 +1,7 @@
 package resolve
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net"
@@ -58,15 +59,73 @@ func newResolver(servers []string) *dns_resolver.DnsResolver {
 }
 
 func (t *ResolveWorker) Resolve(host string) (resolved net.IP, cname string, err error) {
-	return resolveWithCache(host, t.resolver, t.crawlResolve.resolveCache)
+	return first(t.ResolveAll(host))
+}
+
+func (t *ResolveWorker) ResolveContext(ctx context.Context, host string) (resolved net.IP, cname string, err error) {
+	return first(t.ResolveAllContext(ctx, host))
+}
+
+// ResolveAll returns the A then AAAA addresses of host
+func (t *ResolveWorker) ResolveAll(host string) (resolved []net.IP, cname string, err error) {
+	return resolveWithCache(host, t.resolver, t.crawlResolve.servers, t.crawlResolve.resolveCache)
+}
+
+func (t *ResolveWorker) ResolveAllContext(ctx context.Context, host string) (resolved []net.IP, cname string, err error) {
+	return resolveContext(ctx, host, t.resolver, t.crawlResolve.servers, t.crawlResolve.resolveCache)
 }
 
 // Resolve with the crawlers cache
 func (t *Resolver) Resolve(host string) (resolved net.IP, cname string, err error) {
-	return resolveWithCache(host, t.resolver, t.resolveCache)
+	return first(t.ResolveAll(host))
+}
+
+func (t *Resolver) ResolveContext(ctx context.Context, host string) (resolved net.IP, cname string, err error) {
+	return first(t.ResolveAllContext(ctx, host))
+}
+
+// ResolveAll returns the A then AAAA addresses of host
+func (t *Resolver) ResolveAll(host string) (resolved []net.IP, cname string, err error) {
+	return resolveWithCache(host, t.resolver, t.servers, t.resolveCache)
+}
+
+func (t *Resolver) ResolveAllContext(ctx context.Context, host string) (resolved []net.IP, cname string, err error) {
+	return resolveContext(ctx, host, t.resolver, t.servers, t.resolveCache)
+}
+
+func first(ips []net.IP, cname string, err error) (net.IP, string, error) {
+	if err != nil {
+		return nil, "", err
+	}
+	return ips[0], cname, nil
 }
 
-func resolveWithCache(host string, resolver *dns_resolver.DnsResolver, cache *lru.Cache) (resolved net.IP, cname string, err error) {
+type resolveResult struct {
+	ips   []net.IP
+	cname string
+	err   error
+}
+
+// The dns client has no cancellation, so give up waiting on it instead.
+// The lookup finishes on its own within the client timeout.
+func resolveContext(ctx context.Context, host string, resolver *dns_resolver.DnsResolver, servers []string, cache *lru.Cache) (resolved []net.IP, cname string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	resC := make(chan resolveResult, 1)
+	go func() {
+		ips, cname, err := resolveWithCache(host, resolver, servers, cache)
+		resC <- resolveResult{ips, cname, err}
+	}()
+	select {
+	case res := <-resC:
+		return res.ips, res.cname, res.err
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	}
+}
+
+func resolveWithCache(host string, resolver *dns_resolver.DnsResolver, servers []string, cache *lru.Cache) (resolved []net.IP, cname string, err error) {
 	var expired bool
 	// Hit cache first
 	tmp, found := cache.Get(host)
@@ -77,7 +136,7 @@ func resolveWithCache(host string, resolver *dns_resolver.DnsResolver, cache *lr
 	}
 	if !found || expired {
 		// Do resolve
-		resolved, err = resolve(resolver, host)
+		resolved, err = resolve(resolver, servers, host)
 		cname := ""
 		if err != nil {
 			return nil, "", err
@@ -89,20 +148,40 @@ func resolveWithCache(host string, resolver *dns_resolver.DnsResolver, cache *lr
 	} else {
 		// log.Println("Resolve cached: ", host)
 		item := tmp.(*cacheItem)
-		resolved = item.ip
+		resolved = item.ips
 		cname = item.cname
 	}
 	return resolved, cname, nil
 }
 
-func resolve(resolver *dns_resolver.DnsResolver, host string) (resolved net.IP, err error) {
+func resolve(resolver *dns_resolver.DnsResolver, servers []string, host string) (resolved []net.IP, err error) {
+	// Literals need no lookup
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	type lookupResult struct {
+		ips []net.IP
+		err error
+	}
+	v6C := make(chan lookupResult, 1)
+	go func() {
+		ips, err := lookupAAAA(servers, host)
+		v6C <- lookupResult{ips, err}
+	}()
+
 	ip, err := resolver.LookupHost(host)
-	if err != nil {
+	v6 := <-v6C
+
+	resolved = append(ip, v6.ips...)
+	if len(resolved) == 0 {
+		if err == nil {
+			err = v6.err
+		}
+		if err == nil {
+			err = errors.New("No results")
+		}
 		return nil, err
-	} else if len(ip) == 0 {
-		return nil, errors.New("No results")
-	} else {
-		resolved = ip[0]
 	}
 	return resolved, nil
 }
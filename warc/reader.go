@@ -0,0 +1,131 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jbrady42/crawl/data"
+)
+
+// Reader reads records from a WARC file. Gzip compressed
+// files are detected and decompressed.
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	// Check for gzip magic
+	magic, _ := br.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+	}
+	return &Reader{r: br}, nil
+}
+
+// Next returns the next record or io.EOF when done
+func (t *Reader) Next() (*Record, error) {
+	// Find version line
+	var line string
+	for {
+		l, err := t.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(l) == "" {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		line = strings.TrimSpace(l)
+		if line != "" {
+			break
+		}
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, errors.New("warc: bad version line: " + line)
+	}
+
+	rec := &Record{}
+	length := -1
+	for {
+		l, err := t.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		l = strings.TrimRight(l, "\r\n")
+		if l == "" {
+			break
+		}
+		parts := strings.SplitN(l, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("warc: bad header line: " + l)
+		}
+		name := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		if strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(value)
+			if err != nil {
+				return nil, errors.New("warc: bad content length: " + value)
+			}
+			continue
+		}
+		rec.Add(name, value)
+	}
+	if length < 0 {
+		return nil, errors.New("warc: missing content length")
+	}
+
+	rec.Block = make([]byte, length)
+	if _, err := io.ReadFull(t.r, rec.Block); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// PageFromRecord builds page data from a response record
+func PageFromRecord(rec *Record) (*data.PageResult, error) {
+	if rec.Type() != TypeResponse {
+		return nil, errors.New("warc: not a response record")
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(rec.Block)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err == nil {
+			reader = gz
+		}
+	}
+	// Keep what we can from short blocks
+	body, err := ioutil.ReadAll(reader)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+
+	page := data.NewPageData(rec.Get("WARC-Target-URI"), resp, body)
+	if date := rec.Date(); !date.IsZero() {
+		page.Data.Timestamp = date.String()
+	}
+	page.Data.IP = net.ParseIP(rec.Get("WARC-IP-Address"))
+	page.Data.ContentLength = resp.ContentLength
+	page.Data.BytesRead = int64(len(body))
+	page.Data.Truncated = err != nil || rec.Get("WARC-Truncated") != ""
+	return page, nil
+}
@@ -0,0 +1,84 @@
+package warc
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	Version    = "WARC/1.1"
+	dateLayout = "2006-01-02T15:04:05.999999999Z"
+)
+
+// Record types
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeRequest  = "request"
+	TypeResponse = "response"
+	TypeMetadata = "metadata"
+)
+
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Record is a single WARC record. Header fields are kept in order
+// and with their original case.
+type Record struct {
+	Fields []Field
+	Block  []byte
+}
+
+func NewRecord(recType string, date time.Time) *Record {
+	rec := &Record{}
+	rec.Add("WARC-Type", recType)
+	rec.Add("WARC-Record-ID", newRecordID())
+	rec.Add("WARC-Date", date.UTC().Format(dateLayout))
+	return rec
+}
+
+func (t *Record) Add(name, value string) {
+	t.Fields = append(t.Fields, Field{name, value})
+}
+
+// Get returns the first value for the named field, ignoring case
+func (t *Record) Get(name string) string {
+	for _, f := range t.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+func (t *Record) Type() string {
+	return t.Get("WARC-Type")
+}
+
+func (t *Record) ID() string {
+	return t.Get("WARC-Record-ID")
+}
+
+func (t *Record) Date() time.Time {
+	date, _ := time.Parse(time.RFC3339Nano, t.Get("WARC-Date"))
+	return date
+}
+
+func newRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	// Version 4, variant 10
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func digest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
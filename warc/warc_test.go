@@ -0,0 +1,121 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jbrady42/crawl/data"
+)
+
+func testPage(url string, body []byte, truncated bool) *data.PageResult {
+	req, _ := http.NewRequest("GET", url, nil)
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/octet-stream"}},
+		Request:    req,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+	page := data.NewPageData(url, resp, body)
+	page.Data.IP = net.ParseIP("192.0.2.7")
+	page.Data.Truncated = truncated
+	return page
+}
+
+func TestWriteReadPage(t *testing.T) {
+	pages := []*data.PageResult{
+		testPage("http://example.com/a?x=1", []byte("\x00\x01binary\xff body"), false),
+		testPage("http://example.com/b", []byte("cut short"), true),
+	}
+
+	var buf bytes.Buffer
+	writer := NewWriter(&buf)
+	for _, page := range pages {
+		if err := writer.WritePage(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Info, then response, request and metadata for each page
+	members := 0
+	br := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+	gz, err := gzip.NewReader(br)
+	for err == nil {
+		gz.Multistream(false)
+		text, readErr := ioutil.ReadAll(gz)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		if n := bytes.Count(text, []byte(Version+"\r\n")); n != 1 {
+			t.Errorf("gzip member %d holds %d records", members, n)
+		}
+		members++
+		err = gz.Reset(br)
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	if members != 7 {
+		t.Errorf("wrote %d gzip members, want 7", members)
+	}
+
+	reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read []*data.PageResult
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rec.Get("WARC-Block-Digest"); got != digest(rec.Block) {
+			t.Errorf("%s record block digest %s, want %s", rec.Type(), got, digest(rec.Block))
+		}
+		if rec.Type() != TypeResponse {
+			continue
+		}
+
+		page, err := PageFromRecord(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := rec.Get("WARC-Payload-Digest"), digest(page.Data.BodyBytes()); got != want {
+			t.Errorf("payload digest %s, want %s", got, want)
+		}
+		read = append(read, page)
+	}
+
+	if len(read) != len(pages) {
+		t.Fatalf("read %d pages, want %d", len(read), len(pages))
+	}
+	for i, page := range read {
+		want := pages[i].Data
+		got := page.Data
+		if got.Url != want.Url {
+			t.Errorf("target uri %s, want %s", got.Url, want.Url)
+		}
+		if !got.IP.Equal(want.IP) {
+			t.Errorf("%s ip %v, want %v", want.Url, got.IP, want.IP)
+		}
+		if !bytes.Equal(got.BodyBytes(), want.BodyBytes()) {
+			t.Errorf("%s body %q, want %q", want.Url, got.BodyBytes(), want.BodyBytes())
+		}
+		if got.Truncated != want.Truncated {
+			t.Errorf("%s truncated %v, want %v", want.Url, got.Truncated, want.Truncated)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jbrady42/crawl/data"
+)
+
+const software = "crawl"
+
+// Writer writes pages as gzip compressed WARC records,
+// one gzip member per record.
+type Writer struct {
+	w         io.Writer
+	wroteInfo bool
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (t *Writer) WriteRecord(rec *Record) error {
+	var buf bytes.Buffer
+	buf.WriteString(Version + "\r\n")
+	for _, f := range rec.Fields {
+		fmt.Fprintf(&buf, "%s: %s\r\n", f.Name, f.Value)
+	}
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(rec.Block))
+	buf.Write(rec.Block)
+	buf.WriteString("\r\n\r\n")
+
+	gz := gzip.NewWriter(t.w)
+	if _, err := gz.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// WritePage writes request, response and metadata records for a page.
+// Failed pages only get a metadata record.
+func (t *Writer) WritePage(page *data.PageResult) error {
+	if !t.wroteInfo {
+		if err := t.writeInfo(); err != nil {
+			return err
+		}
+		t.wroteInfo = true
+	}
+
+	pd := page.Data
+	date := pd.Time()
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var respID string
+	if page.Success {
+		resp := responseRecord(pd, date)
+		req := requestRecord(pd, date)
+		respID = resp.ID()
+		req.Add("WARC-Concurrent-To", respID)
+
+		if err := t.WriteRecord(resp); err != nil {
+			return err
+		}
+		if err := t.WriteRecord(req); err != nil {
+			return err
+		}
+	}
+
+	meta := metadataRecord(page, date)
+	if respID != "" {
+		meta.Add("WARC-Refers-To", respID)
+	}
+	return t.WriteRecord(meta)
+}
+
+func (t *Writer) writeInfo() error {
+	rec := NewRecord(TypeWarcinfo, time.Now())
+	rec.Add("Content-Type", "application/warc-fields")
+
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "software: %s\r\n", software)
+	fmt.Fprintf(&block, "format: WARC File Format 1.1\r\n")
+	fmt.Fprintf(&block, "conformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n")
+	rec.Block = block.Bytes()
+	rec.Add("WARC-Block-Digest", digest(rec.Block))
+
+	return t.WriteRecord(rec)
+}
+
+func responseRecord(pd *data.PageData, date time.Time) *Record {
+	body := pd.BodyBytes()
+
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "%s %s\r\n", pd.Proto, pd.Status)
+	pd.Header.Write(&block)
+	block.WriteString("\r\n")
+	block.Write(body)
+
+	rec := NewRecord(TypeResponse, date)
+	rec.Add("WARC-Target-URI", targetUri(pd))
+	if pd.IP != nil {
+		rec.Add("WARC-IP-Address", pd.IP.String())
+	}
+	if pd.Truncated {
+		rec.Add("WARC-Truncated", "length")
+	}
+	rec.Add("Content-Type", "application/http;msgtype=response")
+	rec.Block = block.Bytes()
+	rec.Add("WARC-Block-Digest", digest(rec.Block))
+	rec.Add("WARC-Payload-Digest", digest(body))
+	return rec
+}
+
+func requestRecord(pd *data.PageData, date time.Time) *Record {
+	var block bytes.Buffer
+	target := "/"
+	host := ""
+	if u, err := url.Parse(targetUri(pd)); err == nil {
+		target = u.RequestURI()
+		host = u.Host
+	}
+	fmt.Fprintf(&block, "GET %s %s\r\n", target, pd.Proto)
+	fmt.Fprintf(&block, "Host: %s\r\n", host)
+	header := pd.RequestHeader
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Write(&block)
+	block.WriteString("\r\n")
+
+	rec := NewRecord(TypeRequest, date)
+	rec.Add("WARC-Target-URI", targetUri(pd))
+	if pd.IP != nil {
+		rec.Add("WARC-IP-Address", pd.IP.String())
+	}
+	rec.Add("Content-Type", "application/http;msgtype=request")
+	rec.Block = block.Bytes()
+	rec.Add("WARC-Block-Digest", digest(rec.Block))
+	return rec
+}
+
+func metadataRecord(page *data.PageResult, date time.Time) *Record {
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "success: %t\r\n", page.Success)
+	if page.Message != "" {
+		fmt.Fprintf(&block, "message: %s\r\n", page.Message)
+	}
+	for _, hop := range page.Data.Redirects {
+		fmt.Fprintf(&block, "redirect: %d %s %s\r\n", hop.StatusCode, hop.Url, hop.Location)
+	}
+
+	rec := NewRecord(TypeMetadata, date)
+	rec.Add("WARC-Target-URI", page.Data.Url)
+	rec.Add("Content-Type", "application/warc-fields")
+	rec.Block = block.Bytes()
+	rec.Add("WARC-Block-Digest", digest(rec.Block))
+	return rec
+}
+
+// Records describe the url the body came from
+func targetUri(pd *data.PageData) string {
+	if pd.FinalUrl != "" {
+		return pd.FinalUrl
+	}
+	return pd.Url
+}